@@ -10,35 +10,51 @@ import (
 
 const AUTH_URL = "https://api.backblazeb2.com/b2api/v1/b2_authorize_account"
 
+// Allowed describes what an application key can do.
+type Allowed struct {
+	Capabilities []Capability `json:"capabilities"`
+	BucketId     string       `json:"bucketId,omitempty"`
+	BucketName   string       `json:"bucketName,omitempty"`
+	NamePrefix   string       `json:"namePrefix,omitempty"`
+}
+
 type AuthResponse struct {
-	AccountId               string `json:"accountId"`
-	AuthorizationToken      string `json:"authorizationToken"`
-	ApiUrl                  string `json:"apiUrl"`
-	DownloadUrl             string `json:"downloadUrl"`
-	RecommendedPartSize     int64  `json:"recommendedPartSize"`
-	AbsoluteMinimumPartSize int64  `json:"absoluteMinimumPartSize"`
+	// AccountId is the account of the key, it differs from the key id unless the master key is used.
+	AccountId               string  `json:"accountId"`
+	AuthorizationToken      string  `json:"authorizationToken"`
+	ApiUrl                  string  `json:"apiUrl"`
+	DownloadUrl             string  `json:"downloadUrl"`
+	RecommendedPartSize     int64   `json:"recommendedPartSize"`
+	AbsoluteMinimumPartSize int64   `json:"absoluteMinimumPartSize"`
+	Allowed                 Allowed `json:"allowed"`
 }
 
 // Auth your account
 func (b *B2) Auth() error {
-	request, err := http.NewRequest("GET", AUTH_URL, nil)
+	authUrl := b.AuthUrl
+	if authUrl == "" {
+		authUrl = AUTH_URL
+	}
+
+	request, err := http.NewRequest("GET", authUrl, nil)
 	if err != nil {
 		return err
 	}
 
-	request.SetBasicAuth(b.AccountId, b.ApplicationKey)
+	request.SetBasicAuth(b.keyId(), b.ApplicationKey)
 
-	client := &http.Client{}
-	response, err := client.Do(request)
+	response, err := b.doRequest("b2_authorize_account", request, 0)
 	if err != nil {
 		return err
 	}
 
 	switch response.StatusCode {
 	case 200:
-		if err = unmarshalResponseBody(response, &b.auth); err != nil {
+		var auth AuthResponse
+		if err = unmarshalResponseBody(response, &auth); err != nil {
 			return err
 		}
+		b.SetAuth(auth)
 		return nil
 	case 401:
 		return handleErrorResponse(response)
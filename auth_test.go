@@ -0,0 +1,105 @@
+// Copyright 2018 hryyan. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package b2
+
+import (
+	"testing"
+)
+
+func TestMasterKey(t *testing.T) {
+	fs := newFakeServer(t)
+	client := fs.authedClient(t)
+
+	if _, err := client.CreateBucket("logs", PRIVATE, nil, nil, nil); err != nil {
+		t.Fatalf("Create bucket failed: %s", err.Error())
+	}
+
+	buckets, err := client.ListBuckets("", "", "")
+	if err != nil {
+		t.Fatalf("List buckets failed: %s", err.Error())
+	}
+	if len(buckets) != 1 || buckets[0].BucketName != "logs" {
+		t.Fatalf("Should see bucket logs, return %d buckets", len(buckets))
+	}
+}
+
+func TestBucketRestrictedKey(t *testing.T) {
+	fs := newFakeServer(t)
+	logs := fs.addBucket("logs")
+	fs.addBucket("backups")
+	fs.addFile(logs.BucketId, "2018/app.log")
+	key := fs.addKey([]Capability{LIST_BUCKETS, LIST_FILES}, logs.BucketId, "")
+
+	client := fs.authedClient(t, key)
+
+	auth := client.GetAuth()
+	if auth.AccountId != fs.accountId {
+		t.Fatalf("Account id should be %s, got %s", fs.accountId, auth.AccountId)
+	}
+	if auth.Allowed.BucketId != logs.BucketId || auth.Allowed.BucketName != "logs" {
+		t.Fatalf("Key should be restricted to bucket logs, got %+v", auth.Allowed)
+	}
+
+	buckets, err := client.ListBuckets("", "", "")
+	if err != nil {
+		t.Fatalf("List buckets failed: %s", err.Error())
+	}
+	if len(buckets) != 1 || buckets[0].BucketId != logs.BucketId {
+		t.Fatalf("Should see only bucket logs, return %d buckets", len(buckets))
+	}
+
+	if _, err = client.ListBuckets("", "backups", ""); err == nil {
+		t.Fatal("List buckets outside the restriction should fail")
+	}
+
+	if _, err = client.CreateBucket("other", PRIVATE, nil, nil, nil); err == nil {
+		t.Fatal("Create bucket with a restricted key should fail")
+	}
+
+	files, err := client.ListFileNames(logs.BucketId, "", "", "", 100)
+	if err != nil {
+		t.Fatalf("List file names failed: %s", err.Error())
+	}
+	if len(files) != 1 {
+		t.Fatalf("Should see one file, return %d files", len(files))
+	}
+}
+
+func TestPrefixRestrictedKey(t *testing.T) {
+	fs := newFakeServer(t)
+	logs := fs.addBucket("logs")
+	fs.addFile(logs.BucketId, "app/1.log")
+	fs.addFile(logs.BucketId, "db/1.log")
+	key := fs.addKey([]Capability{LIST_BUCKETS, LIST_FILES}, logs.BucketId, "app/")
+
+	client := fs.authedClient(t, key)
+
+	if prefix := client.GetAuth().Allowed.NamePrefix; prefix != "app/" {
+		t.Fatalf("Key should be restricted to prefix app/, got %s", prefix)
+	}
+
+	files, err := client.ListFileNames(logs.BucketId, "", "app/", "", 100)
+	if err != nil {
+		t.Fatalf("List file names failed: %s", err.Error())
+	}
+	if len(files) != 1 || files[0].FileName != "app/1.log" {
+		t.Fatalf("Should see only app/1.log, return %d files", len(files))
+	}
+
+	for _, prefix := range []string{"", "db/"} {
+		if _, err = client.ListFileNames(logs.BucketId, "", prefix, "", 100); err == nil {
+			t.Fatalf("List file names with prefix %q should fail", prefix)
+		}
+	}
+}
+
+func TestDeprecatedAccountId(t *testing.T) {
+	fs := newFakeServer(t)
+	client := fs.client("", fs.masterKey)
+	client.AccountId = fs.accountId
+	if err := client.Auth(); err != nil {
+		t.Fatalf("Auth with AccountId failed: %s", err.Error())
+	}
+}
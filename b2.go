@@ -5,17 +5,51 @@
 // Package b2 is a go library for backblaze B2 Cloud Storage.
 package b2
 
-// B2 is used to initialize your b2 account and applicationkey
+import (
+	"sync"
+)
+
+// B2 is used to initialize your b2 account and applicationkey.
+// A B2 is safe for concurrent use by multiple goroutines once
+// its exported fields are set.
 type B2 struct {
+	// KeyId is the application key id, which is the account id for the master key.
+	KeyId string
+	// AccountId is used as KeyId if KeyId is empty.
+	//
+	// Deprecated: use KeyId. The account id used by requests is AuthResponse.AccountId.
 	AccountId      string
 	ApplicationKey string
-	auth           AuthResponse
+	// AuthUrl defaults to AUTH_URL.
+	AuthUrl string
+	// Observer is notified after every request if not nil.
+	Observer Observer
+	// MaxRetries is how many times a request failing with a transport error, 408, 429
+	// or 5xx is sent again. Uploads, whose body can not be replayed, are never retried.
+	MaxRetries int
+	// Limiter throttles uploads and downloads if not nil.
+	Limiter *RateLimiter
+
+	mu   sync.RWMutex
+	auth AuthResponse
+}
+
+// keyId return the application key id used to authorize the account.
+func (b *B2) keyId() string {
+	if b.KeyId != "" {
+		return b.KeyId
+	}
+	return b.AccountId
 }
 
 func (b *B2) GetAuth() AuthResponse {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
 	return b.auth
 }
 
 func (b *B2) SetAuth(auth AuthResponse) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 	b.auth = auth
 }
@@ -129,11 +129,14 @@ func (t *FileTests) TestSmallFile() {
 		}
 	}()
 	// upload file1 version1
-	fileV1, err := b2.UploadFile(uploadUrlToken, FILE, func(done int64, total int64) {
+	fileV1, err := b2.UploadFile(uploadUrlToken, FILE, ProgressListenerFunc(func(event *ProgressEvent) {
+		if event.Type != BytesTransferred {
+			return
+		}
 		mutex.Lock()
-		uploaded, fileSize = done, total
+		uploaded, fileSize = event.Done, event.Total
 		mutex.Unlock()
-	})
+	}))
 	if err != nil {
 		log.Println(err.Error())
 		t.Test.Fatal("Upload file failed!")
@@ -182,11 +185,14 @@ func (t *FileTests) TestSmallFile() {
 		}
 	}()
 	// upload file1 version2
-	fileV2, err := b2.UploadFile(uploadUrlToken, FILE, func(done int64, total int64) {
+	fileV2, err := b2.UploadFile(uploadUrlToken, FILE, ProgressListenerFunc(func(event *ProgressEvent) {
+		if event.Type != BytesTransferred {
+			return
+		}
 		mutex.Lock()
-		uploaded, fileSize = done, total
+		uploaded, fileSize = event.Done, event.Total
 		mutex.Unlock()
-	})
+	}))
 	if err != nil {
 		log.Println(err.Error())
 		t.Test.Fatal("Upload file failed!")
@@ -261,9 +267,12 @@ func (t *FileTests) TestSmallFile() {
 
 	fileName := fmt.Sprintf("%s.v1", FILE)
 	if err = b2.DownloadFileById(fileV1Info.FileId, fileName,
-		true, func(done int64, total int64) {
-			downloaded, fileSize = done, total
-		}); err != nil {
+		true, ProgressListenerFunc(func(event *ProgressEvent) {
+			if event.Type != BytesTransferred {
+				return
+			}
+			downloaded, fileSize = event.Done, event.Total
+		})); err != nil {
 		log.Println(err.Error())
 		t.Test.Fatal("Download file version1 failed(by file version)!")
 	} else {
@@ -307,9 +316,12 @@ func (t *FileTests) TestSmallFile() {
 
 	fileName = fmt.Sprintf("%s.v2", FILE)
 	if err = b2.DownloadFileByName(bucket.BucketName, fileV2Info.FileName,
-		fileName, true, func(done int64, total int64) {
-			downloaded, fileSize = done, total
-		}); err != nil {
+		fileName, true, ProgressListenerFunc(func(event *ProgressEvent) {
+			if event.Type != BytesTransferred {
+				return
+			}
+			downloaded, fileSize = event.Done, event.Total
+		})); err != nil {
 		log.Println(err.Error())
 		t.Test.Fatal("Download file version2 failed(by file name)!")
 	} else {
@@ -442,11 +454,14 @@ func (t *FileTests) TestLargeFile() {
 			}
 		}()
 
-		part1ContentSha1, err := b2.UploadPart(uploadUrlToken, FILE, 0, 5000000, 1, func(done int64, total int64) {
+		part1ContentSha1, err := b2.UploadPart(uploadUrlToken, FILE, 0, 5000000, 1, ProgressListenerFunc(func(event *ProgressEvent) {
+			if event.Type != BytesTransferred {
+				return
+			}
 			mutex.Lock()
-			uploaded, fileSize = done, total
+			uploaded, fileSize = event.Done, event.Total
 			mutex.Unlock()
-		})
+		}))
 		if err != nil {
 			log.Println(err.Error())
 			t.Test.Fatal("Upload part 1 failed!")
@@ -474,11 +489,14 @@ func (t *FileTests) TestLargeFile() {
 			}
 		}()
 
-		part2ContentSha1, err := b2.UploadPart(uploadUrlToken, FILE, 5000000, 10000000, 2, func(done int64, total int64) {
+		part2ContentSha1, err := b2.UploadPart(uploadUrlToken, FILE, 5000000, 5000000, 2, ProgressListenerFunc(func(event *ProgressEvent) {
+			if event.Type != BytesTransferred {
+				return
+			}
 			mutex.Lock()
-			uploaded, fileSize = done, total
+			uploaded, fileSize = event.Done, event.Total
 			mutex.Unlock()
-		})
+		}))
 		if err != nil {
 			log.Println(err.Error())
 			t.Test.Fatal("Upload part 2 failed!")
@@ -531,11 +549,14 @@ func (t *FileTests) TestLargeFile() {
 		defer t.RemoveFile(fileName)
 
 		if err = b2.DownloadFileByName(bucket.BucketName, file.FileName, fileName,
-			true, func(done int64, total int64) {
+			true, ProgressListenerFunc(func(event *ProgressEvent) {
+				if event.Type != BytesTransferred {
+					return
+				}
 				mutex.Lock()
-				downloaded, fileSize = done, total
+				downloaded, fileSize = event.Done, event.Total
 				mutex.Unlock()
-			}); err != nil {
+			})); err != nil {
 			log.Println(err.Error())
 			t.Test.Fatal("Download large file failed(by file name!)")
 		}
@@ -606,11 +627,14 @@ func (t *FileTests) TestLargeFile() {
 			}
 		}()
 		_, err = b2.UploadPart(uploadUrlToken, FILE, 0, 5000000,
-			1, func(done int64, total int64) {
+			1, ProgressListenerFunc(func(event *ProgressEvent) {
+				if event.Type != BytesTransferred {
+					return
+				}
 				mutex.Lock()
-				uploaded, fileSize = done, total
+				uploaded, fileSize = event.Done, event.Total
 				mutex.Unlock()
-			})
+			}))
 		if err != nil {
 			log.Println(err.Error())
 			t.Test.Fatal("Upload part 1 failed!")
@@ -645,8 +669,16 @@ func (t *FileTests) TestLargeFile() {
 	}
 }
 
+func skipWithoutAccount(t *testing.T) {
+	if b2 == nil {
+		t.Skip("B2_ACCOUNT_ID and B2_APPLICATION_KEY are not set")
+	}
+}
+
 func TestKey(t *testing.T) {
-	ak, err := b2.CreateKey([]string{LIST_KEYS}, "testKey", 0, "", "")
+	skipWithoutAccount(t)
+
+	ak, err := b2.CreateKey([]Capability{LIST_KEYS}, "testKey", 0, "", "")
 	if err != nil {
 		log.Println(err.Error())
 		t.Fatal("Create key failed!")
@@ -676,6 +708,8 @@ func TestKey(t *testing.T) {
 }
 
 func TestFile(t *testing.T) {
+	skipWithoutAccount(t)
+
 	t.Run("A=create", func(t *testing.T) {
 		test := FileTests{Test: t, BucketName: randName(16)}
 		test.TestSmallFile()
@@ -685,9 +719,13 @@ func TestFile(t *testing.T) {
 
 func setup() {
 	once.Do(func() {
-		accountId, applicationKey := getKeyFromEnv()
+		keyId, applicationKey := getKeyFromEnv()
+		if keyId == "" || applicationKey == "" {
+			return
+		}
+
 		b2 = &B2{
-			AccountId:      accountId,
+			KeyId:          keyId,
 			ApplicationKey: applicationKey,
 		}
 
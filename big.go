@@ -6,7 +6,6 @@ package b2
 
 import (
 	"fmt"
-	"io"
 	"os"
 	"strconv"
 )
@@ -19,7 +18,7 @@ import (
 // StartLargeFile return a File array and an error.
 func (b *B2) StartLargeFile(bucketId, fileName string, fileInfo map[string]string) (*File, error) {
 	var (
-		url         = fmt.Sprintf("%s/b2api/v1/b2_start_large_file", b.auth.ApiUrl)
+		url         = fmt.Sprintf("%s/b2api/v1/b2_start_large_file", b.GetAuth().ApiUrl)
 		requestBody = &struct {
 			BucketId    string            `json:"bucketId"`
 			FileName    string            `json:"fileName"`
@@ -55,7 +54,7 @@ func (b *B2) StartLargeFile(bucketId, fileName string, fileInfo map[string]strin
 // GetUploadPartUrl return a File pointer and an error.
 func (b *B2) GetUploadPartUrl(fileId string) (*UploadUrlToken, error) {
 	var (
-		url                     = fmt.Sprintf("%s/b2api/v1/b2_get_upload_part_url", b.auth.ApiUrl)
+		url                     = fmt.Sprintf("%s/b2api/v1/b2_get_upload_part_url", b.GetAuth().ApiUrl)
 		getUploadPartUrlRequest = &struct {
 			FileId string `json:"fileId"`
 		}{FileId: fileId}
@@ -84,33 +83,54 @@ func (b *B2) GetUploadPartUrl(fileId string) (*UploadUrlToken, error) {
 // See "b2_upload_part" for an introduction:
 // https://www.backblaze.com/b2/docs/b2_upload_part.html
 //
-// All parameters are required.
+// All parameters except listener are required. Pass a Transfer as listener
+// to aggregate the progress of parallel parts.
 // UploadPart return a content sha1 and an error.
 func (b *B2) UploadPart(uploadUrlToken *UploadUrlToken, filePath string, offset, size, partNumber int64,
-	progress func(int64, int64)) (string, error) {
-	contentSha1 := ""
+	listener ProgressListener) (string, error) {
 	f, err := os.Open(filePath)
 	if err != nil {
-		return contentSha1, err
+		return "", err
 	}
+	defer f.Close()
 
-	f.Seek(io.SeekStart, int(offset))
 	buf := make([]byte, size)
-	if _, err := f.Read(buf); err != nil {
-		return contentSha1, err
+	if _, err := f.ReadAt(buf, offset); err != nil {
+		return "", err
 	}
 
+	return b.UploadPartBytes(uploadUrlToken, buf, partNumber, listener)
+}
+
+// UploadPartBytes upload a part held in memory like UploadPart,
+// such as a part read from a stream.
+// UploadPartBytes return a content sha1 and an error.
+func (b *B2) UploadPartBytes(uploadUrlToken *UploadUrlToken, buf []byte, partNumber int64,
+	listener ProgressListener) (string, error) {
+	size := int64(len(buf))
 	headers := map[string]string{
 		"X-Bz-Part-Number": strconv.FormatInt(partNumber, 10),
 	}
 
-	response, contentSha1, err := b.makeUploadRequest(uploadUrlToken, buf, headers, progress)
+	if listener != nil {
+		listener.OnProgress(&ProgressEvent{Type: PartStarted, PartNumber: partNumber, PartSize: size})
+	}
+
+	response, contentSha1, err := b.makeUploadRequest(uploadUrlToken, buf, headers, partNumber, listener)
 	if err != nil {
 		return contentSha1, err
 	}
 
 	switch {
 	case response.StatusCode == 200:
+		if listener != nil {
+			listener.OnProgress(&ProgressEvent{
+				Type:       PartFinished,
+				PartNumber: partNumber,
+				PartDone:   size,
+				PartSize:   size,
+			})
+		}
 		return contentSha1, nil
 	case response.StatusCode == 400 || response.StatusCode == 401:
 		return contentSha1, handleErrorResponse(response)
@@ -125,18 +145,26 @@ func (b *B2) UploadPart(uploadUrlToken *UploadUrlToken, filePath string, offset,
 //
 // All parameters are required.
 // ListParts return uploaded parts of a large file.
-func (b *B2) ListParts(fileId string, startPartNumber int64, maxPartNumber int64) ([]*Part, error) {
+func (b *B2) ListParts(fileId string, startPartNumber int64, maxPartCount int64) ([]*Part, error) {
+	page, err := b.ListPartsPage(fileId, startPartNumber, maxPartCount)
+	if err != nil {
+		return nil, err
+	}
+	return page.Parts, nil
+}
+
+// ListPartsPage lists a page of parts like ListParts,
+// pass Parts.NextPartNumber as startPartNumber to get the next page.
+// ListPartsPage return a Parts pointer and an error.
+func (b *B2) ListPartsPage(fileId string, startPartNumber int64, maxPartCount int64) (*Parts, error) {
 	var (
-		url         = fmt.Sprintf("%s/b2api/v1/b2_list_parts", b.auth.ApiUrl)
+		url         = fmt.Sprintf("%s/b2api/v1/b2_list_parts", b.GetAuth().ApiUrl)
 		requestBody = &struct {
 			FileId          string `json:"fileId"`
-			StartPartNumber int64  `json:"startPartNumber"`
-			maxPartNumber   int64  `json:"maxPartNumber"`
-		}{fileId, startPartNumber, maxPartNumber}
-		responseBody = &struct {
-			Parts          []*Part `json:"parts"`
-			NextPartNumber int64   `json:"nextPartNumber"`
-		}{}
+			StartPartNumber int64  `json:"startPartNumber,omitempty"`
+			MaxPartCount    int64  `json:"maxPartCount,omitempty"`
+		}{fileId, startPartNumber, maxPartCount}
+		responseBody = &Parts{}
 	)
 
 	response, err := b.makeAuthedRequest(url, requestBody)
@@ -149,13 +177,12 @@ func (b *B2) ListParts(fileId string, startPartNumber int64, maxPartNumber int64
 		if err = unmarshalResponseBody(response, responseBody); err != nil {
 			return nil, err
 		}
-		return responseBody.Parts, nil
+		return responseBody, nil
 	case response.StatusCode == 400 || response.StatusCode == 401:
 		return nil, handleErrorResponse(response)
 	default:
 		return nil, handleUnknownResponse(response)
 	}
-
 }
 
 // ListUnfinishedLargeFiles lists unfinished large files.
@@ -165,18 +192,27 @@ func (b *B2) ListParts(fileId string, startPartNumber int64, maxPartNumber int64
 // All parameters are required.
 // ListUnfinishedLargeFiles return an array of file and an error.
 func (b *B2) ListUnfinishedLargeFiles(bucketId, namePrefix string, startFileId string, maxfileCount int64) ([]*File, error) {
+	page, err := b.ListUnfinishedLargeFilesPage(bucketId, namePrefix, startFileId, maxfileCount)
+	if err != nil {
+		return nil, err
+	}
+	return page.Files, nil
+}
+
+// ListUnfinishedLargeFilesPage lists a page of unfinished large files like ListUnfinishedLargeFiles,
+// pass UnfinishedLargeFiles.NextFileId as startFileId to get the next page.
+// ListUnfinishedLargeFilesPage return an UnfinishedLargeFiles pointer and an error.
+func (b *B2) ListUnfinishedLargeFilesPage(bucketId, namePrefix string, startFileId string,
+	maxfileCount int64) (*UnfinishedLargeFiles, error) {
 	var (
-		url         = fmt.Sprintf("%s/b2api/v1/b2_list_unfinished_large_files", b.auth.ApiUrl)
+		url         = fmt.Sprintf("%s/b2api/v1/b2_list_unfinished_large_files", b.GetAuth().ApiUrl)
 		requestBody = &struct {
 			BucketId     string `json:"bucketId"`
 			NamePrefix   string `json:"namePrefix,omitempty"`
 			StartFileId  string `json:"startFileId,omitempty"`
 			MaxFileCount int64  `json:"maxFileCount,omitempty"`
 		}{bucketId, namePrefix, startFileId, maxfileCount}
-		responseBody = &struct {
-			Files      []*File `json:"files"`
-			NextFileId string  `json:"nextFileId"`
-		}{}
+		responseBody = &UnfinishedLargeFiles{}
 	)
 
 	response, err := b.makeAuthedRequest(url, requestBody)
@@ -189,7 +225,7 @@ func (b *B2) ListUnfinishedLargeFiles(bucketId, namePrefix string, startFileId s
 		if err = unmarshalResponseBody(response, responseBody); err != nil {
 			return nil, err
 		}
-		return responseBody.Files, nil
+		return responseBody, nil
 	case response.StatusCode == 400 || response.StatusCode == 401:
 		return nil, handleErrorResponse(response)
 	default:
@@ -205,7 +241,7 @@ func (b *B2) ListUnfinishedLargeFiles(bucketId, namePrefix string, startFileId s
 // FinishLargeFile return a file pointer and an error.
 func (b *B2) FinishLargeFile(fileId string, partSha1Array []string) (*File, error) {
 	var (
-		url         = fmt.Sprintf("%s/b2api/v1/b2_finish_large_file", b.auth.ApiUrl)
+		url         = fmt.Sprintf("%s/b2api/v1/b2_finish_large_file", b.GetAuth().ApiUrl)
 		requestBody = &struct {
 			FileId        string   `json:"fileId"`
 			PartSha1Array []string `json:"partSha1Array"`
@@ -239,7 +275,7 @@ func (b *B2) FinishLargeFile(fileId string, partSha1Array []string) (*File, erro
 // CancelLargeFile return an error.
 func (b *B2) CancelLargeFile(fileId string) error {
 	var (
-		url         = fmt.Sprintf("%s/b2api/v1/b2_cancel_large_file", b.auth.ApiUrl)
+		url         = fmt.Sprintf("%s/b2api/v1/b2_cancel_large_file", b.GetAuth().ApiUrl)
 		requestBody = &struct {
 			FileId string `json:"fileId"`
 		}{fileId}
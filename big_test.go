@@ -0,0 +1,40 @@
+// Copyright 2018 hryyan. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package b2
+
+import (
+	"testing"
+)
+
+func TestListPartsPage(t *testing.T) {
+	fs := newFakeServer(t)
+	bucket := fs.addBucket("backup")
+	file := fs.addFile(bucket.BucketId, "disk.img")
+	for _, n := range []int64{3, 1, 2} {
+		fs.addPart(file.FileId, n, n*100)
+	}
+
+	client := fs.authedClient(t)
+
+	page, err := client.ListPartsPage(file.FileId, 1, 2)
+	if err != nil {
+		t.Fatalf("List parts failed: %s", err.Error())
+	}
+	if len(page.Parts) != 2 || page.Parts[0].PartNumber != 1 || page.Parts[1].PartNumber != 2 ||
+		page.NextPartNumber != 3 {
+		t.Fatalf("Wrong first page %+v", page)
+	}
+	if page.Parts[1].ContentLength != 200 || page.Parts[1].ContentSha1 != "sha1-2" {
+		t.Fatalf("Wrong part %+v", page.Parts[1])
+	}
+
+	parts, err := client.ListParts(file.FileId, page.NextPartNumber, 2)
+	if err != nil {
+		t.Fatalf("List parts failed: %s", err.Error())
+	}
+	if len(parts) != 1 || parts[0].PartNumber != 3 {
+		t.Fatalf("Wrong last page %+v", parts)
+	}
+}
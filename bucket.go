@@ -17,7 +17,7 @@ import (
 func (b *B2) CreateBucket(bucketName, bucketType string, bucketInfo map[string]string,
 	corsRules []CorsRule, lifecycleRules []LifecycleRule) (*Bucket, error) {
 	var (
-		url         = fmt.Sprintf("%s/b2api/v1/b2_create_bucket", b.auth.ApiUrl)
+		url         = fmt.Sprintf("%s/b2api/v1/b2_create_bucket", b.GetAuth().ApiUrl)
 		requestBody = &struct {
 			AccountId      string            `json:"accountId"`
 			BucketName     string            `json:"bucketName"`
@@ -25,7 +25,7 @@ func (b *B2) CreateBucket(bucketName, bucketType string, bucketInfo map[string]s
 			BucketInfo     map[string]string `json:"bucketInfo,omitempty"`
 			CorsRules      []CorsRule        `json:"corsRules,omitempty"`
 			LifecycleRules []LifecycleRule   `json:"lifecycleRules,omitempty"`
-		}{b.AccountId, bucketName, bucketType, bucketInfo, corsRules, lifecycleRules}
+		}{b.GetAuth().AccountId, bucketName, bucketType, bucketInfo, corsRules, lifecycleRules}
 		responseBody = &Bucket{}
 	)
 
@@ -55,11 +55,11 @@ func (b *B2) CreateBucket(bucketName, bucketType string, bucketInfo map[string]s
 // DeleteBucket returned nil if success, return error if failed.
 func (b *B2) DeleteBucket(bucketId string) error {
 	var (
-		url         = fmt.Sprintf("%s/b2api/v1/b2_delete_bucket", b.auth.ApiUrl)
+		url         = fmt.Sprintf("%s/b2api/v1/b2_delete_bucket", b.GetAuth().ApiUrl)
 		requestBody = &struct {
 			AccountId string `json:"accountId"`
 			BucketId  string `json:"bucketId,omitempty"`
-		}{b.AccountId, bucketId}
+		}{b.GetAuth().AccountId, bucketId}
 	)
 
 	response, err := b.makeAuthedRequest(url, requestBody)
@@ -83,30 +83,42 @@ func (b *B2) DeleteBucket(bucketId string) error {
 // https://www.backblaze.com/b2/docs/b2_update_bucket.html
 //
 // Parameter bucket is required, you can pass ifRevisionIs as false for simplicity.
+// If ifRevisionIs is true, the bucket is updated only if it is still at bucket.Revision,
+// so concurrent updates do not clobber each other.
+// Bucket info, CORS rules and lifecycle rules are cleared if they are empty but not nil.
 // UpdateBucket returned a bucket pointer and an error.
 func (b *B2) UpdateBucket(bucket *Bucket, ifRevisionIs bool) (*Bucket, error) {
 	var (
-		url         = fmt.Sprintf("%s/b2api/v1/b2_update_bucket", b.auth.ApiUrl)
+		url         = fmt.Sprintf("%s/b2api/v1/b2_update_bucket", b.GetAuth().ApiUrl)
 		requestBody = &struct {
-			AccountId      string            `json:"accountId"`
-			BucketId       string            `json:"bucketId"`
-			BucketInfo     map[string]string `json:"bucketInfo,omitempty"`
-			BucketType     string            `json:"bucketType,omitempty"`
-			CorsRules      []CorsRule        `json:"corsRules,omitempty"`
-			LifecycleRules []LifecycleRule   `json:"lifecycleRules,omitempty"`
-			IfRevisionIs   bool              `json:"ifRevisionIs,omitempty"`
+			AccountId      string             `json:"accountId"`
+			BucketId       string             `json:"bucketId"`
+			BucketInfo     *map[string]string `json:"bucketInfo,omitempty"`
+			BucketType     string             `json:"bucketType,omitempty"`
+			CorsRules      *[]CorsRule        `json:"corsRules,omitempty"`
+			LifecycleRules *[]LifecycleRule   `json:"lifecycleRules,omitempty"`
+			IfRevisionIs   int64              `json:"ifRevisionIs,omitempty"`
 		}{
-			b.AccountId,
-			bucket.BucketId,
-			bucket.BucketInfo,
-			bucket.BucketType,
-			bucket.CorsRules,
-			bucket.LifecycleRules,
-			ifRevisionIs,
+			AccountId:  b.GetAuth().AccountId,
+			BucketId:   bucket.BucketId,
+			BucketType: bucket.BucketType,
 		}
 		responseBody = &Bucket{}
 	)
 
+	if bucket.BucketInfo != nil {
+		requestBody.BucketInfo = &bucket.BucketInfo
+	}
+	if bucket.CorsRules != nil {
+		requestBody.CorsRules = &bucket.CorsRules
+	}
+	if bucket.LifecycleRules != nil {
+		requestBody.LifecycleRules = &bucket.LifecycleRules
+	}
+	if ifRevisionIs {
+		requestBody.IfRevisionIs = bucket.Revision
+	}
+
 	response, err := b.makeAuthedRequest(url, requestBody)
 	if err != nil {
 		return nil, err
@@ -118,7 +130,7 @@ func (b *B2) UpdateBucket(bucket *Bucket, ifRevisionIs bool) (*Bucket, error) {
 			return nil, err
 		}
 		return responseBody, nil
-	case response.StatusCode == 400 || response.StatusCode == 401:
+	case response.StatusCode == 400 || response.StatusCode == 401 || response.StatusCode == 409:
 		return nil, handleErrorResponse(response)
 	default:
 		return nil, handleUnknownResponse(response)
@@ -131,18 +143,25 @@ func (b *B2) UpdateBucket(bucket *Bucket, ifRevisionIs bool) (*Bucket, error) {
 // https://www.backblaze.com/b2/docs/b2_list_buckets.html
 //
 // All parameter are optional, you can pass empty value for simplicity.
+// If the key is restricted to a bucket and neither bucketId nor bucketName is given, that bucket is listed.
 // List returned a bucket array and an error.
 func (b *B2) ListBuckets(bucketId, bucketName, bucketTypes string) ([]*Bucket, error) {
+	auth := b.GetAuth()
+	if bucketId == "" && bucketName == "" && auth.Allowed.BucketId != "" {
+		// keys restricted to a bucket must name the bucket
+		bucketId = auth.Allowed.BucketId
+	}
+
 	var (
-		url         = fmt.Sprintf("%s/b2api/v1/b2_list_buckets", b.auth.ApiUrl)
+		url         = fmt.Sprintf("%s/b2api/v1/b2_list_buckets", auth.ApiUrl)
 		requestBody = &struct {
 			AccountId   string `json:"accountId"`
 			BucketId    string `json:"bucketId,omitempty"`
 			BucketName  string `json:"bucketName,omitempty"`
 			BucketTypes string `json:"bucketTypes,omitempty"`
-		}{b.AccountId, bucketId, bucketName, bucketTypes}
+		}{auth.AccountId, bucketId, bucketName, bucketTypes}
 		responseBody = &struct {
-			Buckets []*Bucket `json: "buckets"`
+			Buckets []*Bucket `json:"buckets"`
 		}{}
 	)
 
@@ -0,0 +1,47 @@
+// Copyright 2018 hryyan. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package b2
+
+import (
+	"testing"
+)
+
+func TestUpdateBucketRevision(t *testing.T) {
+	fs := newFakeServer(t)
+	fs.addBucket("site")
+
+	client := fs.authedClient(t)
+
+	buckets, err := client.ListBuckets("", "site", "")
+	if err != nil || len(buckets) != 1 {
+		t.Fatalf("List buckets failed: %v", err)
+	}
+	first, second := *buckets[0], *buckets[0]
+
+	first.CorsRules = []CorsRule{{CorsRuleName: "downloadFromAnyOrigin", AllowedOrigins: []string{"*"}}}
+	updated, err := client.UpdateBucket(&first, true)
+	if err != nil {
+		t.Fatalf("Update bucket failed: %s", err.Error())
+	}
+	if updated.Revision != first.Revision+1 || len(updated.CorsRules) != 1 {
+		t.Fatalf("Wrong updated bucket %+v", updated)
+	}
+
+	second.BucketInfo = map[string]string{"owner": "web"}
+	if _, err = client.UpdateBucket(&second, true); err == nil {
+		t.Fatal("Update bucket with a stale revision should fail")
+	}
+	if code := ErrorCode(err); code != "conflict" {
+		t.Fatalf("Wrong error code %q, want conflict", code)
+	}
+
+	updated.CorsRules = []CorsRule{}
+	if updated, err = client.UpdateBucket(updated, true); err != nil {
+		t.Fatalf("Update bucket failed: %s", err.Error())
+	}
+	if len(updated.CorsRules) != 0 {
+		t.Fatalf("CORS rules should be cleared, got %d rules", len(updated.CorsRules))
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright 2018 hryyan. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package b2
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Capability is a permission granted to an application key.
+// Capabilities unknown to this package are kept as is when decoded.
+type Capability string
+
+const (
+	LIST_KEYS                  Capability = "listKeys"
+	WRITE_KEYS                 Capability = "writeKeys"
+	DELETE_KEYS                Capability = "deleteKeys"
+	LIST_BUCKETS               Capability = "listBuckets"
+	LIST_ALL_BUCKET_NAMES      Capability = "listAllBucketNames"
+	READ_BUCKETS               Capability = "readBuckets"
+	WRITE_BUCKETS              Capability = "writeBuckets"
+	DELETE_BUCKETS             Capability = "deleteBuckets"
+	READ_BUCKET_RETENTIONS     Capability = "readBucketRetentions"
+	WRITE_BUCKET_RETENTIONS    Capability = "writeBucketRetentions"
+	READ_BUCKET_ENCRYPTION     Capability = "readBucketEncryption"
+	WRITE_BUCKET_ENCRYPTION    Capability = "writeBucketEncryption"
+	READ_BUCKET_REPLICATIONS   Capability = "readBucketReplications"
+	WRITE_BUCKET_REPLICATIONS  Capability = "writeBucketReplications"
+	READ_BUCKET_NOTIFICATIONS  Capability = "readBucketNotifications"
+	WRITE_BUCKET_NOTIFICATIONS Capability = "writeBucketNotifications"
+	LIST_FILES                 Capability = "listFiles"
+	READ_FILES                 Capability = "readFiles"
+	SHARE_FILES                Capability = "shareFiles"
+	WRITE_FILES                Capability = "writeFiles"
+	DELETE_FILES               Capability = "deleteFiles"
+	READ_FILE_LEGAL_HOLDS      Capability = "readFileLegalHolds"
+	WRITE_FILE_LEGAL_HOLDS     Capability = "writeFileLegalHolds"
+	READ_FILE_RETENTIONS       Capability = "readFileRetentions"
+	WRITE_FILE_RETENTIONS      Capability = "writeFileRetentions"
+	BYPASS_GOVERNANCE          Capability = "bypassGovernance"
+)
+
+// AllCapabilities is every capability known to this package.
+var AllCapabilities = []Capability{
+	LIST_KEYS, WRITE_KEYS, DELETE_KEYS,
+	LIST_BUCKETS, LIST_ALL_BUCKET_NAMES, READ_BUCKETS, WRITE_BUCKETS, DELETE_BUCKETS,
+	READ_BUCKET_RETENTIONS, WRITE_BUCKET_RETENTIONS,
+	READ_BUCKET_ENCRYPTION, WRITE_BUCKET_ENCRYPTION,
+	READ_BUCKET_REPLICATIONS, WRITE_BUCKET_REPLICATIONS,
+	READ_BUCKET_NOTIFICATIONS, WRITE_BUCKET_NOTIFICATIONS,
+	LIST_FILES, READ_FILES, SHARE_FILES, WRITE_FILES, DELETE_FILES,
+	READ_FILE_LEGAL_HOLDS, WRITE_FILE_LEGAL_HOLDS,
+	READ_FILE_RETENTIONS, WRITE_FILE_RETENTIONS,
+	BYPASS_GOVERNANCE,
+}
+
+// accountCapabilities can not be granted to a key restricted to a bucket.
+var accountCapabilities = []Capability{
+	LIST_KEYS, WRITE_KEYS, DELETE_KEYS,
+	LIST_ALL_BUCKET_NAMES, WRITE_BUCKETS, DELETE_BUCKETS,
+}
+
+// Known report whether c is one of AllCapabilities.
+func (c Capability) Known() bool {
+	return containsCapability(AllCapabilities, c)
+}
+
+func containsCapability(capabilities []Capability, c Capability) bool {
+	for _, capability := range capabilities {
+		if capability == c {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseCapabilities parse a comma separated list like "readFiles,listFiles".
+func ParseCapabilities(s string) ([]Capability, error) {
+	var capabilities []Capability
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		c := Capability(item)
+		if !c.Known() {
+			return nil, fmt.Errorf("Unknown capability %s", item)
+		}
+		capabilities = append(capabilities, c)
+	}
+	return capabilities, nil
+}
+
+// KeySpec is the scope of an application key.
+type KeySpec struct {
+	Capabilities []Capability
+	BucketId     string
+	NamePrefix   string
+}
+
+// Validate check the capability combination before calling b2_create_key.
+// Capabilities unknown to this package are left for b2 to check,
+// so that keys copied from b2 can be recreated.
+func (spec *KeySpec) Validate() error {
+	if len(spec.Capabilities) == 0 {
+		return fmt.Errorf("At least one capability is required")
+	}
+	if spec.NamePrefix != "" && spec.BucketId == "" {
+		return fmt.Errorf("Name prefix %s requires a bucket", spec.NamePrefix)
+	}
+
+	seen := map[Capability]bool{}
+	for _, c := range spec.Capabilities {
+		if seen[c] {
+			return fmt.Errorf("Duplicated capability %s", c)
+		}
+		seen[c] = true
+
+		if spec.BucketId != "" && containsCapability(accountCapabilities, c) {
+			return fmt.Errorf("Capability %s can not be restricted to a bucket", c)
+		}
+	}
+	return nil
+}
+
+// ReadOnly return a spec to list and download files, bucketId and namePrefix are optional.
+func ReadOnly(bucketId, namePrefix string) *KeySpec {
+	capabilities := []Capability{LIST_BUCKETS, LIST_FILES, READ_FILES}
+	if bucketId == "" {
+		capabilities = append(capabilities, READ_BUCKETS)
+	}
+	return &KeySpec{capabilities, bucketId, namePrefix}
+}
+
+// WriteOnly return a spec to upload files, bucketId and namePrefix are optional.
+func WriteOnly(bucketId, namePrefix string) *KeySpec {
+	return &KeySpec{[]Capability{LIST_BUCKETS, WRITE_FILES}, bucketId, namePrefix}
+}
+
+// Admin return a spec with every capability except BYPASS_GOVERNANCE.
+func Admin() *KeySpec {
+	var capabilities []Capability
+	for _, c := range AllCapabilities {
+		if c != BYPASS_GOVERNANCE {
+			capabilities = append(capabilities, c)
+		}
+	}
+	return &KeySpec{Capabilities: capabilities}
+}
@@ -0,0 +1,78 @@
+// Copyright 2018 hryyan. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package b2
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestKeySpecValidate(t *testing.T) {
+	valid := []*KeySpec{
+		ReadOnly("", ""),
+		ReadOnly("bucket0001", "logs/"),
+		WriteOnly("bucket0001", ""),
+		Admin(),
+		{Capabilities: []Capability{BYPASS_GOVERNANCE}},
+		{Capabilities: []Capability{READ_FILES, "readTheFuture"}, BucketId: "bucket0001"},
+	}
+	for _, spec := range valid {
+		if err := spec.Validate(); err != nil {
+			t.Errorf("%+v should be valid: %s", spec, err.Error())
+		}
+	}
+
+	invalid := []*KeySpec{
+		{},
+		{Capabilities: []Capability{READ_FILES, READ_FILES}},
+		{Capabilities: []Capability{READ_FILES}, NamePrefix: "logs/"},
+		{Capabilities: []Capability{LIST_KEYS}, BucketId: "bucket0001"},
+		{Capabilities: []Capability{LIST_BUCKETS, WRITE_BUCKETS}, BucketId: "bucket0001"},
+		{Capabilities: []Capability{LIST_ALL_BUCKET_NAMES}, BucketId: "bucket0001"},
+	}
+	for _, spec := range invalid {
+		if err := spec.Validate(); err == nil {
+			t.Errorf("%+v should be invalid", spec)
+		}
+	}
+}
+
+func TestUnknownCapabilityDecoding(t *testing.T) {
+	data := []byte(`{"applicationKeyId":"k","capabilities":["readFiles","readTheFuture"]}`)
+
+	var key ApplicationKey
+	if err := json.Unmarshal(data, &key); err != nil {
+		t.Fatal(err)
+	}
+	if len(key.Capabilities) != 2 || key.Capabilities[1] != "readTheFuture" || key.Capabilities[1].Known() {
+		t.Fatalf("Unknown capability should be kept, got %v", key.Capabilities)
+	}
+
+	encoded, err := json.Marshal(key.Capabilities)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(encoded) != `["readFiles","readTheFuture"]` {
+		t.Fatalf("Unknown capability should be encoded as is, got %s", encoded)
+	}
+}
+
+func TestCreateKeyWithSpec(t *testing.T) {
+	fs := newFakeServer(t)
+	logs := fs.addBucket("logs")
+	client := fs.authedClient(t)
+
+	key, err := client.CreateKeyWithSpec("reader", 3600, ReadOnly(logs.BucketId, "app/"))
+	if err != nil {
+		t.Fatalf("Create key failed: %s", err.Error())
+	}
+	if key.BucketId != logs.BucketId || key.NamePrefix != "app/" || len(key.Capabilities) != 3 {
+		t.Fatalf("Key should be read only in logs/app/, got %+v", key)
+	}
+
+	if _, err = client.CreateKey([]Capability{DELETE_KEYS}, "bad", 0, logs.BucketId, ""); err == nil {
+		t.Fatal("Create key with an invalid capability combination should fail")
+	}
+}
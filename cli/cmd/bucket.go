@@ -0,0 +1,247 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/hryyan/b2"
+	"github.com/spf13/cobra"
+)
+
+var (
+	bucketFormat    string
+	bucketCors      string
+	bucketLifecycle string
+	bucketInfo      []string
+	bucketType      string
+)
+
+func checkBucketFormat() error {
+	if bucketFormat != "json" && bucketFormat != "yaml" {
+		return withExitCode(errors.New("--format should be json or yaml!"), WRONG_ARGS_EXIT)
+	}
+	return nil
+}
+
+// updateBucket update bucket if it is still at its revision.
+func updateBucket(client *b2.B2, bucket *b2.Bucket) error {
+	updated, err := client.UpdateBucket(bucket, true)
+	if e, ok := err.(*b2.ErrorResponse); ok && e.Code == "conflict" {
+		conflict := *e
+		conflict.Message = fmt.Sprintf("%s\nBucket %s is changed by others since revision %d, please retry!",
+			e.Error(), bucket.BucketName, bucket.Revision)
+		return withExitCode(&conflict, B2_LIBRARY_ERROR_EXIT)
+	} else if err != nil {
+		return withExitCode(err, B2_LIBRARY_ERROR_EXIT)
+	}
+	return printResult(updated, func() {
+		fmt.Printf("Update bucket %s to revision %d successed!\n", updated.BucketName, updated.Revision)
+	})
+}
+
+var getBucketCmd = &cobra.Command{
+	Use:   "get name",
+	Short: "Print the configuration of a bucket",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := checkBucketFormat(); err != nil {
+			return err
+		}
+		_, bucket, err := loginBucket(args[0])
+		if err != nil {
+			return err
+		}
+
+		if machineOutput() {
+			return printResult(bucket, nil)
+		}
+		b, err := marshal(bucket, bucketFormat == "yaml")
+		if err != nil {
+			return withExitCode(err, OPERATION_ERROR_EXIT)
+		}
+		fmt.Println(strings.TrimSpace(string(b)))
+		return nil
+	},
+}
+
+var setBucketCmd = &cobra.Command{
+	Use:   "set name",
+	Short: "Set the type, CORS rules, lifecycle rules or info of a bucket",
+	Long: `Set the type, CORS rules, lifecycle rules or info of a bucket.
+CORS and lifecycle rules are read from JSON or YAML files, an empty list
+clears the rules. --info k= removes the key k.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if bucketType != "" && bucketType != b2.PUBLIC && bucketType != b2.PRIVATE {
+			return withExitCode(fmt.Errorf("--type should be %s or %s!", b2.PUBLIC, b2.PRIVATE), WRONG_ARGS_EXIT)
+		}
+
+		var (
+			corsRules      []b2.CorsRule
+			lifecycleRules []b2.LifecycleRule
+		)
+		if bucketCors != "" {
+			if err := readConfigFile(bucketCors, &corsRules); err != nil {
+				return withExitCode(err, WRONG_ARGS_EXIT)
+			}
+			if corsRules == nil {
+				corsRules = []b2.CorsRule{}
+			}
+		}
+		if bucketLifecycle != "" {
+			if err := readConfigFile(bucketLifecycle, &lifecycleRules); err != nil {
+				return withExitCode(err, WRONG_ARGS_EXIT)
+			}
+			if lifecycleRules == nil {
+				lifecycleRules = []b2.LifecycleRule{}
+			}
+		}
+
+		client, bucket, err := loginBucket(args[0])
+		if err != nil {
+			return err
+		}
+
+		if bucketType != "" {
+			bucket.BucketType = bucketType
+		}
+		if corsRules != nil {
+			bucket.CorsRules = corsRules
+		}
+		if lifecycleRules != nil {
+			bucket.LifecycleRules = lifecycleRules
+		}
+		for _, kv := range bucketInfo {
+			parts := strings.SplitN(kv, "=", 2)
+			if len(parts) != 2 || parts[0] == "" {
+				return withExitCode(fmt.Errorf("Wrong bucket info %s, use key=value!", kv), WRONG_ARGS_EXIT)
+			}
+
+			if bucket.BucketInfo == nil {
+				bucket.BucketInfo = map[string]string{}
+			}
+			if parts[1] == "" {
+				delete(bucket.BucketInfo, parts[0])
+			} else {
+				bucket.BucketInfo[parts[0]] = parts[1]
+			}
+		}
+
+		return updateBucket(client, bucket)
+	},
+}
+
+var editBucketCmd = &cobra.Command{
+	Use:   "edit name",
+	Short: "Edit the configuration of a bucket with $EDITOR",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := checkBucketFormat(); err != nil {
+			return err
+		}
+		asYAML := bucketFormat == "yaml"
+
+		client, bucket, err := loginBucket(args[0])
+		if err != nil {
+			return err
+		}
+
+		original, err := marshal(bucket, asYAML)
+		if err != nil {
+			return withExitCode(err, OPERATION_ERROR_EXIT)
+		}
+
+		f, err := ioutil.TempFile("", "b2-bucket-*."+bucketFormat)
+		if err != nil {
+			return withExitCode(err, OPERATION_ERROR_EXIT)
+		}
+		defer os.Remove(f.Name())
+		f.Write(original)
+		f.Close()
+
+		editor := os.Getenv("EDITOR")
+		if editor == "" {
+			editor = "vi"
+		}
+		editorCmd := exec.Command("sh", "-c", editor+` "$0"`, f.Name())
+		editorCmd.Stdin, editorCmd.Stdout, editorCmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if err = editorCmd.Run(); err != nil {
+			return withExitCode(err, OPERATION_ERROR_EXIT)
+		}
+
+		edited, err := ioutil.ReadFile(f.Name())
+		if err != nil {
+			return withExitCode(err, OPERATION_ERROR_EXIT)
+		}
+		if bytes.Equal(bytes.TrimSpace(edited), bytes.TrimSpace(original)) {
+			fmt.Fprintln(messageOutput(), "Nothing changed.")
+			return nil
+		}
+
+		changed := &b2.Bucket{}
+		if err = unmarshal(edited, changed, asYAML); err != nil {
+			return withExitCode(err, WRONG_ARGS_EXIT)
+		}
+		if changed.BucketId != bucket.BucketId || changed.BucketName != bucket.BucketName {
+			return withExitCode(errors.New("The id and the name of a bucket can not be changed!"), WRONG_ARGS_EXIT)
+		}
+
+		// edits are based on the revision we printed, not the one in the file
+		changed.Revision = bucket.Revision
+		if changed.BucketInfo == nil {
+			changed.BucketInfo = map[string]string{}
+		}
+		if changed.CorsRules == nil {
+			changed.CorsRules = []b2.CorsRule{}
+		}
+		if changed.LifecycleRules == nil {
+			changed.LifecycleRules = []b2.LifecycleRule{}
+		}
+		return updateBucket(client, changed)
+	},
+}
+
+var bucketCmd = &cobra.Command{
+	Use:   "bucket command",
+	Short: "Get or change the configuration of buckets",
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{getBucketCmd, editBucketCmd} {
+		cmd.Flags().StringVar(
+			&bucketFormat,
+			"format",
+			"json",
+			"format of the configuration: json or yaml")
+	}
+
+	setBucketCmd.Flags().StringVar(
+		&bucketType,
+		"type",
+		"",
+		"bucket type: allPublic or allPrivate")
+	setBucketCmd.Flags().StringVar(
+		&bucketCors,
+		"cors",
+		"",
+		"JSON or YAML file of CORS rules")
+	setBucketCmd.Flags().StringVar(
+		&bucketLifecycle,
+		"lifecycle",
+		"",
+		"JSON or YAML file of lifecycle rules")
+	setBucketCmd.Flags().StringArrayVar(
+		&bucketInfo,
+		"info",
+		nil,
+		"bucket info as key=value, can be repeated")
+
+	bucketCmd.AddCommand(getBucketCmd, setBucketCmd, editBucketCmd)
+
+	rootCmd.AddCommand(bucketCmd)
+}
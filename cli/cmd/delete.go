@@ -2,41 +2,125 @@ package cmd
 
 import (
 	"fmt"
-	"os"
 
+	"github.com/hryyan/b2"
 	"github.com/spf13/cobra"
 )
 
+var deleteBucketForce bool
+
+// emptyBucket delete all file versions and cancel all unfinished large files of bucket.
+func emptyBucket(client *b2.B2, bucket *b2.Bucket) ([]string, error) {
+	versions, err := listVersions(client, bucket.BucketId, "")
+	if err != nil {
+		return nil, err
+	}
+	unfinished, err := listUnfinished(client, bucket.BucketId, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		items   = make([]string, 0, len(versions)+len(unfinished))
+		targets = map[string]func() error{}
+	)
+
+	for _, version := range versions {
+		version := version
+		item := fmt.Sprintf("%s (%s)", version.FileName, version.FileId)
+		items = append(items, item)
+		targets[item] = func() error {
+			return client.DeleteFileVersion(version.FileName, version.FileId)
+		}
+	}
+	for _, file := range unfinished {
+		file := file
+		item := fmt.Sprintf("%s (%s, unfinished)", file.FileName, file.FileId)
+		items = append(items, item)
+		targets[item] = func() error {
+			return client.CancelLargeFile(file.FileId)
+		}
+	}
+
+	var (
+		p   = newProgress()
+		bar = newBar(p, bucket.BucketName, int64(len(items)))
+	)
+	failures := forEach(concurrency, items, func(item string) error {
+		err := targets[item]()
+		bar.Increment()
+		return err
+	})
+	if len(items) == 0 {
+		p.Abort(bar, false)
+	}
+	p.Wait()
+
+	return failures, nil
+}
+
 var deleteBucketCmd = &cobra.Command{
 	Use:   "bucket [bucket ..]",
 	Short: "Delete bucket",
-	Args:  cobra.MinimumNArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		client := login()
+	Long: `Delete buckets. A bucket with files can be deleted with --force, which
+deletes every file version and cancels the unfinished large files first.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := login()
+		if err != nil {
+			return err
+		}
 		buckets, err := client.ListBuckets("", "", "")
 		if err != nil {
-			fmt.Println(err.Error())
-			os.Exit(B2_LIBRARY_ERROR_EXIT)
+			return withExitCode(err, B2_LIBRARY_ERROR_EXIT)
+		}
+		if concurrency < 1 {
+			concurrency = 1
 		}
 
+		var deleted []*b2.Bucket
+		kept := false
 		for _, name := range args {
 			found := false
 			for _, bucket := range buckets {
 				if name == bucket.BucketName {
 					found = true
-					err := client.DeleteBucket(bucket.BucketId)
-					if err != nil {
-						fmt.Println(err.Error())
-						os.Exit(OPERATION_ERROR_EXIT)
+
+					if deleteBucketForce {
+						if !confirmName(fmt.Sprintf("All files in %s will be deleted!", name), name) {
+							fmt.Fprintf(messageOutput(), "Keep bucket %s.\n", name)
+							kept = true
+							continue
+						}
+						failures, err := emptyBucket(client, bucket)
+						if err != nil {
+							return err
+						}
+						if len(failures) > 0 {
+							fmt.Fprintf(messageOutput(), "Can not empty bucket %s, %d failed.\n", name, len(failures))
+							return failuresError(failures)
+						}
+					}
+
+					if err := client.DeleteBucket(bucket.BucketId); err != nil {
+						return withExitCode(err, OPERATION_ERROR_EXIT)
 					}
+					deleted = append(deleted, bucket)
 				}
 			}
 
 			if !found {
-				fmt.Printf("Can not find bucket %s!\n", name)
-				os.Exit(OPERATION_ERROR_EXIT)
+				return withExitCode(fmt.Errorf("Can not find bucket %s!", name), NOT_FOUND_EXIT)
 			}
 		}
+
+		if err := printResults(deleted, nil); err != nil {
+			return err
+		}
+		if kept {
+			return errAborted
+		}
+		return nil
 	},
 }
 
@@ -44,46 +128,38 @@ var deleteFileCmd = &cobra.Command{
 	Use:   "file bucket [file ..]",
 	Short: "Delete file",
 	Args:  cobra.MinimumNArgs(2),
-	Run: func(cmd *cobra.Command, args []string) {
-		client := login()
-		bucketName := args[0]
-		buckets, err := client.ListBuckets("", bucketName, "")
-		if err != nil {
-			fmt.Println(err.Error())
-			os.Exit(B2_LIBRARY_ERROR_EXIT)
-		}
-
-		if len(buckets) != 1 {
-			fmt.Println("Can not find bucket %s!\n", bucketName)
-			os.Exit(OPERATION_ERROR_EXIT)
-		}
-
-		bucket := buckets[0]
-		files, err := client.ListFileNames(bucket.BucketId, "", "", "", 10000)
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, bucket, err := loginBucket(args[0])
 		if err != nil {
-			fmt.Println(err.Error())
-			os.Exit(B2_LIBRARY_ERROR_EXIT)
+			return err
 		}
 
+		var deleted []*b2.File
 		for _, arg := range args[1:] {
+			files, err := listFiles(client, bucket.BucketId, arg)
+			if err != nil {
+				return err
+			}
+
 			found := false
 			for _, file := range files {
-				if file.FileName == arg {
-					found = true
-					if err = client.DeleteFileVersion(file.FileName, file.FileId); err != nil {
-						fmt.Println(err.Error())
-						os.Exit(B2_LIBRARY_ERROR_EXIT)
-					} else {
-						return
-					}
+				if file.FileName != arg {
+					continue
 				}
+
+				found = true
+				if err := client.DeleteFileVersion(file.FileName, file.FileId); err != nil {
+					return withExitCode(err, B2_LIBRARY_ERROR_EXIT)
+				}
+				deleted = append(deleted, file)
 			}
 
 			if !found {
-				fmt.Printf("Can not find %s in %s!\n", args[1], args[0])
-				os.Exit(OPERATION_ERROR_EXIT)
+				return withExitCode(fmt.Errorf("Can not find %s in %s!", arg, args[0]), NOT_FOUND_EXIT)
 			}
 		}
+
+		return printResults(deleted, nil)
 	},
 }
 
@@ -93,6 +169,18 @@ var deleteCmd = &cobra.Command{
 }
 
 func init() {
+	deleteBucketCmd.Flags().BoolVar(
+		&deleteBucketForce,
+		"force",
+		false,
+		"delete all files of the bucket first")
+	deleteBucketCmd.Flags().Int64VarP(
+		&concurrency,
+		"concurrency",
+		"c",
+		1,
+		"threads for deleting files")
+
 	deleteCmd.AddCommand(deleteBucketCmd, deleteFileCmd)
 
 	rootCmd.AddCommand(deleteCmd)
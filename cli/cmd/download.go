@@ -2,90 +2,124 @@ package cmd
 
 import (
 	"fmt"
-	"os"
 	"path"
-	"sync"
+	"strings"
 
 	"github.com/hryyan/b2"
 	"github.com/spf13/cobra"
-	"github.com/vbauerster/mpb"
-	"github.com/vbauerster/mpb/decor"
 )
 
 var saveTo string
 
 const MAX_VALID_DURATION_IN_SECONDS = 604800
 
-func downloadFile(client *b2.B2, bucket *b2.Bucket, fileName, filePath string) {
-	var (
-		wg sync.WaitGroup
-		p  = mpb.New(mpb.WithWaitGroup(&wg))
-	)
-
-	bar := p.AddBar(
-		0,
-		mpb.PrependDecorators(
-			decor.Name(fileName, decor.WC{W: len(fileName), C: decor.DidentRight}),
-			decor.Percentage(decor.WCSyncSpace),
-		),
-		mpb.AppendDecorators(
-			decor.AverageSpeed(decor.UnitKiB, "% .2f "),
-			decor.Name("eta: ", decor.WC{W: 5}),
-			decor.OnComplete(
-				decor.AverageETA(decor.ET_STYLE_GO), "Done",
-			),
-		),
-	)
-
-	go func() {
-		wg.Add(1)
-		defer wg.Done()
-
-		var offset int64
-		if err := client.DownloadFileByName(bucket.BucketName, fileName, filePath, true, func(done, total int64) {
-			bar.SetTotal(total, false)
-			bar.IncrBy(int(done - offset))
-			offset = done
-		}); err != nil {
-			fmt.Println(err.Error())
-			os.Exit(B2_LIBRARY_ERROR_EXIT)
-		}
-	}()
+// downloadedFile is the result of downloading a file.
+type downloadedFile struct {
+	*b2.File
+	Path string `json:"path"`
+}
 
+// downloadFile download fileName in one request, for keys which can not list files.
+func downloadFile(client *b2.B2, bucket *b2.Bucket, fileName, filePath string) error {
+	p := newProgress()
+	bar := newBar(p, fileName, 0)
+
+	err := client.DownloadFileByName(bucket.BucketName, fileName, filePath, true, barListener(bar, fileName))
+	if err != nil {
+		p.Abort(bar, false)
+	}
 	p.Wait()
+	return err
+}
+
+// latestFile return the latest version of exactly fileName, nil if it is hidden or missing.
+func latestFile(client *b2.B2, bucket *b2.Bucket, fileName string) (*b2.File, error) {
+	page, err := client.ListFileNamesPage(bucket.BucketId, fileName, fileName, "", 1)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(page.Files) == 0 || page.Files[0].FileName != fileName {
+		return nil, nil
+	}
+	return page.Files[0], nil
 }
 
 var downloadFileCmd = &cobra.Command{
-	Use:   "download bucket file",
-	Short: "Download file",
-	Args:  cobra.ExactArgs(2),
-	Run: func(cmd *cobra.Command, args []string) {
+	Use:   "download bucket [file|prefix/]",
+	Short: "Download a file, or the files under a prefix recursively",
+	Long: `Download a file, or the files under a prefix recursively if the name ends
+with "/" or is omitted, such as: b2 download bucket photos/ --to ./restore
+A file is downloaded in byte ranges into name.b2part, with -c the ranges are
+downloaded concurrently. An interrupted download resumes from the completed
+ranges, the file is renamed to name after its SHA1 is verified.`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
 		var (
 			bucketName = args[0]
-			fileName   = args[1]
+			fileName   = ""
 			filePath   = ""
 		)
-		if saveTo != "" {
+		if len(args) == 2 {
+			fileName = args[1]
+		}
+
+		if fileName == "" || strings.HasSuffix(fileName, "/") {
+			if concurrency < 1 {
+				concurrency = 1
+			}
+			client, bucket, err := loginBucket(bucketName)
+			if err != nil {
+				return err
+			}
+			return downloadDir(client, bucket, fileName, downloadTo, concurrency)
+		}
+
+		if saveTo == STDIO {
+			return catCmd.RunE(cmd, args)
+		} else if saveTo != "" {
 			filePath = saveTo
 		} else {
 			filePath = path.Join(".", fileName)
 		}
 
-		client := login()
+		client, err := login()
+		if err != nil {
+			return err
+		}
 		buckets, err := client.ListBuckets("", bucketName, "")
 		if err != nil {
-			fmt.Println(err.Error())
-			os.Exit(B2_LIBRARY_ERROR_EXIT)
+			return withExitCode(err, B2_LIBRARY_ERROR_EXIT)
 		}
 
 		if len(buckets) != 1 {
-			fmt.Printf("Can not find bucket %s!\n", bucketName)
-			os.Exit(OPERATION_ERROR_EXIT)
+			return withExitCode(fmt.Errorf("Can not find bucket %s!", bucketName), NOT_FOUND_EXIT)
 		}
 
 		bucket := buckets[0]
 
-		downloadFile(client, bucket, fileName, filePath)
+		// keys without listFiles can not look up the file id to resume with,
+		// they download the file in one request instead
+		file, err := latestFile(client, bucket, fileName)
+		if err == nil {
+			if file == nil {
+				return withExitCode(fmt.Errorf("Can not find %s in %s!", fileName, bucket.BucketName), NOT_FOUND_EXIT)
+			}
+			if concurrency < 1 {
+				concurrency = 1
+			}
+			if err = downloadRanges(client, file, filePath, concurrency); err != nil {
+				return err
+			}
+			return printResult(&downloadedFile{File: file, Path: filePath}, nil)
+		} else if errorExitCode(err, B2_LIBRARY_ERROR_EXIT) != PERMISSION_DENIED_EXIT {
+			return withExitCode(err, B2_LIBRARY_ERROR_EXIT)
+		}
+
+		if err = downloadFile(client, bucket, fileName, filePath); err != nil {
+			return withExitCode(err, B2_LIBRARY_ERROR_EXIT)
+		}
+		return printResult(&downloadedFile{File: &b2.File{FileName: fileName}, Path: filePath}, nil)
 	},
 }
 
@@ -95,7 +129,24 @@ func init() {
 		"save",
 		"s",
 		"",
-		"save as file")
+		"save as file, - for stdout")
+	downloadFileCmd.Flags().StringVar(
+		&downloadTo,
+		"to",
+		".",
+		"directory to save the files under a prefix")
+	downloadFileCmd.Flags().StringVar(
+		&downloadAsOf,
+		"as-of",
+		"",
+		"download the versions current at a time, such as 2018-06-01")
+	downloadFileCmd.Flags().Int64VarP(
+		&concurrency,
+		"concurrency",
+		"c",
+		1,
+		"threads for downloading")
+	addLimitRateFlags(downloadFileCmd)
 
 	rootCmd.AddCommand(downloadFileCmd)
 }
@@ -0,0 +1,199 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hryyan/b2"
+	"github.com/vbauerster/mpb"
+)
+
+var (
+	downloadTo   string
+	downloadAsOf string
+)
+
+// downloadJob is a remote file and the local path it is saved to.
+type downloadJob struct {
+	file     *b2.File
+	filePath string
+}
+
+// localPath return the path of fileName under dir with the prefix stripped,
+// it return false for names escaping dir, such as "../etc/passwd".
+func localPath(dir, prefix, fileName string) (string, bool) {
+	rel := strings.TrimPrefix(fileName, prefix)
+	if rel == "" || strings.HasSuffix(rel, "/") {
+		return "", false
+	}
+
+	filePath := filepath.Join(dir, filepath.FromSlash(rel))
+	rel, err := filepath.Rel(filepath.Clean(dir), filePath)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filePath, true
+}
+
+// unchanged report whether the local file has the size and content of file.
+// The modification time is compared if the SHA1 of file is unknown.
+func unchanged(file *b2.File, filePath string) bool {
+	info, err := os.Stat(filePath)
+	if err != nil || !info.Mode().IsRegular() || info.Size() != file.ContentLength {
+		return false
+	}
+
+	if remoteSha1 := file.Sha1(); remoteSha1 != "" {
+		localSha1, err := fileSha1(filePath)
+		return err == nil && localSha1 == remoteSha1
+	}
+
+	return info.ModTime().Unix() == fileModTime(file).Unix()
+}
+
+// fileModTime return the modification time of file from "src_last_modified_millis",
+// its upload time if it was uploaded without.
+func fileModTime(file *b2.File) time.Time {
+	if modified, ok := file.SrcLastModified(); ok {
+		return modified
+	}
+	return time.Unix(file.UploadTimestamp/1000, 0)
+}
+
+// parseAsOf parse a --as-of time like 2018-06-01, 2018-06-01T08:00Z or 2018-06-01T08:00:00Z to milliseconds.
+func parseAsOf(s string) (int64, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04Z07:00", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UnixNano() / int64(time.Millisecond), nil
+		}
+	}
+	return 0, withExitCode(fmt.Errorf("Wrong time %s, use 2006-01-02 or 2006-01-02T15:04:05Z07:00!", s), WRONG_ARGS_EXIT)
+}
+
+// downloadAll download jobs with a pool of workers, the modification times are restored
+// by fileModTime. It return the number of downloaded files and the failures.
+func downloadAll(client *b2.B2, jobs []*downloadJob, workers int64) (int, []string) {
+	var totalSize int64
+	for _, job := range jobs {
+		totalSize += job.file.ContentLength
+	}
+
+	var (
+		p          = newProgress()
+		totalName  = fmt.Sprintf("%d files", len(jobs))
+		total      = newBar(p, totalName, totalSize)
+		queue      = make(chan *downloadJob)
+		pool       sync.WaitGroup
+		mu         sync.Mutex
+		downloaded int
+		failures   []string
+	)
+
+	for i := int64(0); i < workers; i++ {
+		pool.Add(1)
+		go func() {
+			defer pool.Done()
+
+			for job := range queue {
+				var bar *mpb.Bar
+				listener := bytesListener(total, totalName)
+				if job.file.ContentLength > 0 {
+					bar = newBar(p, job.file.FileName, job.file.ContentLength, mpb.BarRemoveOnComplete())
+					fileListener := barListener(bar, job.file.FileName)
+					totalListener := listener
+					listener = b2.ProgressListenerFunc(func(event *b2.ProgressEvent) {
+						fileListener.OnProgress(event)
+						totalListener.OnProgress(event)
+					})
+				}
+
+				err := os.MkdirAll(filepath.Dir(job.filePath), 0755)
+				if err == nil {
+					err = client.DownloadFileById(job.file.FileId, job.filePath, true, listener)
+				}
+				if err == nil {
+					modified := fileModTime(job.file)
+					err = os.Chtimes(job.filePath, modified, modified)
+				}
+
+				mu.Lock()
+				if err != nil {
+					if bar != nil {
+						p.Abort(bar, true)
+					}
+					failures = append(failures, fmt.Sprintf("%s: %s", job.file.FileName, err.Error()))
+				} else {
+					downloaded++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, job := range jobs {
+		queue <- job
+	}
+	close(queue)
+
+	pool.Wait()
+	if len(failures) > 0 || totalSize == 0 {
+		p.Abort(total, false)
+	}
+	p.Wait()
+
+	return downloaded, failures
+}
+
+// downloadDir download the files under prefix to dir, keeping the directory structure.
+func downloadDir(client *b2.B2, bucket *b2.Bucket, prefix, dir string, workers int64) error {
+	var files []*b2.File
+	if downloadAsOf != "" {
+		asOf, err := parseAsOf(downloadAsOf)
+		if err != nil {
+			return err
+		}
+		versions, err := listVersions(client, bucket.BucketId, prefix)
+		if err != nil {
+			return err
+		}
+		files = filesAsOf(versions, asOf)
+	} else {
+		var err error
+		if files, err = listFiles(client, bucket.BucketId, prefix); err != nil {
+			return err
+		}
+	}
+
+	var (
+		jobs     []*downloadJob
+		failures []string
+		skipped  int
+	)
+	for _, file := range files {
+		filePath, ok := localPath(dir, prefix, file.FileName)
+		if !ok {
+			failures = append(failures, fmt.Sprintf("%s: unsafe file name", file.FileName))
+			continue
+		}
+		if unchanged(file, filePath) {
+			skipped++
+			continue
+		}
+		jobs = append(jobs, &downloadJob{file: file, filePath: filePath})
+	}
+
+	downloaded, failed := downloadAll(client, jobs, workers)
+	failures = append(failures, failed...)
+
+	err := printResult(&transferSummary{Transferred: downloaded, Unchanged: skipped, Failures: failures}, func() {
+		fmt.Printf("Downloaded %d files, %d unchanged, %d failed.\n", downloaded, skipped, len(failures))
+	})
+	if err != nil {
+		return err
+	}
+	return failuresError(failures)
+}
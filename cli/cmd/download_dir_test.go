@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/hryyan/b2"
+)
+
+func TestLocalPath(t *testing.T) {
+	for _, check := range []struct {
+		dir, prefix, fileName string
+		want                  string
+		ok                    bool
+	}{
+		{".", "", "a.jpg", "a.jpg", true},
+		{".", "photos/", "photos/2018/a.jpg", "2018/a.jpg", true},
+		{"./", "", "a.jpg", "a.jpg", true},
+		{"/", "", "a.jpg", "/a.jpg", true},
+		{"/", "", "photos/a.jpg", "/photos/a.jpg", true},
+		{"backup", "", "photos/a.jpg", "backup/photos/a.jpg", true},
+		{"backup/", "photos/", "photos/a.jpg", "backup/a.jpg", true},
+		{"/tmp/backup", "", "..a.jpg", "/tmp/backup/..a.jpg", true},
+		{"backup", "", "photos/../a.jpg", "backup/a.jpg", true},
+		{"backup", "photos/", "photos/", "", false},
+		{"backup", "", "photos/", "", false},
+		{"backup", "", "photos/..", "", false},
+		{"backup", "", "../a.jpg", "", false},
+		{"backup", "", "photos/../../a.jpg", "", false},
+		{".", "", "../a.jpg", "", false},
+		{".", "", "..", "", false},
+		{"/tmp/backup", "", "../../etc/passwd", "", false},
+		{"/", "", "../etc/passwd", "/etc/passwd", true},
+	} {
+		got, ok := localPath(filepath.FromSlash(check.dir), check.prefix, check.fileName)
+		if ok != check.ok || got != filepath.FromSlash(check.want) {
+			t.Errorf("localPath(%q, %q, %q) = %q, %v, want %q, %v",
+				check.dir, check.prefix, check.fileName, got, ok, check.want, check.ok)
+		}
+	}
+}
+
+func TestFileModTime(t *testing.T) {
+	file := &b2.File{UploadTimestamp: 1528000000999, FileInfo: b2.FileInfo{}}
+	if got := fileModTime(file).Unix(); got != 1528000000 {
+		t.Errorf("Modification time without src_last_modified_millis = %d, want the upload time", got)
+	}
+
+	file.FileInfo["src_last_modified_millis"] = "1527000000000"
+	if got := fileModTime(file).Unix(); got != 1527000000 {
+		t.Errorf("Modification time = %d, want src_last_modified_millis", got)
+	}
+}
@@ -0,0 +1,274 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/hryyan/b2"
+)
+
+const (
+	PART_SUFFIX    = ".b2part"
+	SIDECAR_SUFFIX = ".b2part.json"
+)
+
+// offsetWriter write to f from off on, so that ranges can be written concurrently.
+type offsetWriter struct {
+	f   *os.File
+	off int64
+}
+
+func (w *offsetWriter) Write(p []byte) (int, error) {
+	n, err := w.f.WriteAt(p, w.off)
+	w.off += int64(n)
+	return n, err
+}
+
+// byteRange is the bytes from start to end inclusive, numbered from 1 like parts.
+type byteRange struct {
+	number int64
+	start  int64
+	end    int64
+}
+
+// splitRanges split size bytes into ranges of rangeSize, the last one may be shorter.
+func splitRanges(size, rangeSize int64) []*byteRange {
+	var ranges []*byteRange
+	for start := int64(0); start < size; start += rangeSize {
+		end := start + rangeSize - 1
+		if end >= size {
+			end = size - 1
+		}
+		ranges = append(ranges, &byteRange{number: int64(len(ranges) + 1), start: start, end: end})
+	}
+	return ranges
+}
+
+// downloadRangeSize return the size of ranges downloading size bytes with workers, ranges are
+// no smaller than the minimum part size and no larger than the recommended part size.
+func downloadRangeSize(client *b2.B2, size, workers int64) int64 {
+	auth := client.GetAuth()
+	rangeSize := (size + workers - 1) / workers
+	if rangeSize > auth.RecommendedPartSize {
+		rangeSize = auth.RecommendedPartSize
+	}
+	if rangeSize < auth.AbsoluteMinimumPartSize {
+		rangeSize = auth.AbsoluteMinimumPartSize
+	}
+	return rangeSize
+}
+
+// rangeListener forward the bytes of a range to transfer as the bytes of a part.
+func rangeListener(transfer *b2.Transfer, number int64) b2.ProgressListener {
+	return b2.ProgressListenerFunc(func(event *b2.ProgressEvent) {
+		if event.Type == b2.BytesTransferred {
+			part := *event
+			part.PartNumber = number
+			transfer.OnProgress(&part)
+		}
+	})
+}
+
+// downloadRange download a range into f, retrying from its start if it failed.
+func downloadRange(client *b2.B2, transfer *b2.Transfer, f *os.File, fileId string, r *byteRange) error {
+	var lastErr error
+	for i := 0; i < PART_RETRIES; i++ {
+		if lastErr != nil {
+			transfer.RetryPart(r.number, lastErr)
+		}
+
+		w := &offsetWriter{f: f, off: r.start}
+		err := client.DownloadFileRangeById(fileId, r.start, r.end, w, true, rangeListener(transfer, r.number))
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+	}
+	return lastErr
+}
+
+// verifySha1 compare the SHA1 of a downloaded file with the one recorded in b2.
+func verifySha1(file *b2.File, filePath string) error {
+	expected := file.Sha1()
+	if expected == "" || expected == "none" {
+		fmt.Fprintf(messageOutput(), "SHA1 of %s is unknown, skip verifying.\n", file.FileName)
+		return nil
+	}
+
+	actual, err := fileSha1(filePath)
+	if err != nil {
+		return err
+	}
+	if actual != expected {
+		return &checksumError{path: filePath, actual: actual, expected: expected}
+	}
+	return nil
+}
+
+// partialDownload is the sidecar of a partial file, recording the completed ranges.
+type partialDownload struct {
+	FileId    string  `json:"fileId"`
+	Sha1      string  `json:"sha1"`
+	Size      int64   `json:"size"`
+	RangeSize int64   `json:"rangeSize"`
+	Done      []int64 `json:"done"`
+}
+
+// readPartial return the sidecar of filePath, nil if it is missing or broken.
+func readPartial(filePath string) *partialDownload {
+	b, err := ioutil.ReadFile(filePath + SIDECAR_SUFFIX)
+	if err != nil {
+		return nil
+	}
+
+	d := &partialDownload{}
+	if err = json.Unmarshal(b, d); err != nil || d.RangeSize <= 0 {
+		return nil
+	}
+	return d
+}
+
+// write replace the sidecar of filePath atomically.
+func (d *partialDownload) write(filePath string) error {
+	b, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+
+	tmp := filePath + SIDECAR_SUFFIX + ".tmp"
+	if err = ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filePath+SIDECAR_SUFFIX)
+}
+
+// openPartial open the partial file of filePath to resume, or create a preallocated
+// one if there is none or it belongs to another version of the file.
+func openPartial(file *b2.File, filePath string, rangeSize int64) (*os.File, *partialDownload, error) {
+	partPath := filePath + PART_SUFFIX
+	d := readPartial(filePath)
+	if d != nil && d.FileId == file.FileId && d.Size == file.ContentLength {
+		if info, err := os.Stat(partPath); err == nil && info.Size() == d.Size {
+			f, err := os.OpenFile(partPath, os.O_RDWR, 0644)
+			return f, d, err
+		}
+	} else if d != nil {
+		fmt.Fprintf(messageOutput(), "%s changed since the last attempt, download it again.\n", file.FileName)
+	}
+
+	d = &partialDownload{
+		FileId:    file.FileId,
+		Sha1:      file.Sha1(),
+		Size:      file.ContentLength,
+		RangeSize: rangeSize,
+	}
+	f, err := os.OpenFile(partPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err == nil {
+		err = f.Truncate(file.ContentLength)
+	}
+	if err == nil {
+		err = d.write(filePath)
+	}
+	return f, d, err
+}
+
+// downloadRanges download file into filePath + PART_SUFFIX with workers concurrent ranges.
+// Completed ranges are recorded in the sidecar, so an interrupted download resumes from
+// them. The partial file is renamed to filePath after its SHA1 is verified.
+func downloadRanges(client *b2.B2, file *b2.File, filePath string, workers int64) error {
+	f, d, err := openPartial(file, filePath, downloadRangeSize(client, file.ContentLength, workers))
+	if err != nil {
+		return withExitCode(err, OPERATION_ERROR_EXIT)
+	}
+
+	var (
+		done      = map[int64]bool{}
+		doneBytes int64
+		pending   []*byteRange
+	)
+	for _, number := range d.Done {
+		done[number] = true
+	}
+	for _, r := range splitRanges(d.Size, d.RangeSize) {
+		if done[r.number] {
+			doneBytes += r.end - r.start + 1
+		} else {
+			pending = append(pending, r)
+		}
+	}
+
+	var (
+		p        = newProgress()
+		bar      = newBar(p, file.FileName, file.ContentLength)
+		transfer = b2.NewTransfer(file.FileName, file.ContentLength, barListener(bar, file.FileName))
+		queue    = make(chan *byteRange)
+		pool     sync.WaitGroup
+		mu       sync.Mutex
+		lastErr  error
+	)
+	transfer.Start()
+	bar.IncrBy(int(doneBytes))
+	if file.ContentLength == 0 {
+		p.Abort(bar, false)
+	}
+
+	for i := int64(0); i < workers; i++ {
+		pool.Add(1)
+		go func() {
+			defer pool.Done()
+
+			for r := range queue {
+				err := downloadRange(client, transfer, f, file.FileId, r)
+				if err == nil {
+					err = f.Sync()
+				}
+
+				mu.Lock()
+				if err == nil {
+					d.Done = append(d.Done, r.number)
+					err = d.write(filePath)
+				}
+				if err != nil {
+					lastErr = err
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, r := range pending {
+		queue <- r
+	}
+	close(queue)
+	pool.Wait()
+
+	if err = f.Close(); lastErr == nil {
+		lastErr = err
+	}
+	transfer.Finish(lastErr)
+	if lastErr != nil {
+		p.Abort(bar, false)
+		p.Wait()
+		return withExitCode(fmt.Errorf("%s\nRun the command again to resume the download.", lastErr),
+			errorExitCode(lastErr, B2_LIBRARY_ERROR_EXIT))
+	}
+	p.Wait()
+
+	partPath := filePath + PART_SUFFIX
+	if err = verifySha1(file, partPath); err != nil {
+		os.Remove(partPath)
+		os.Remove(filePath + SIDECAR_SUFFIX)
+		return withExitCode(err, B2_LIBRARY_ERROR_EXIT)
+	}
+
+	if err = os.Rename(partPath, filePath); err != nil {
+		return withExitCode(err, OPERATION_ERROR_EXIT)
+	}
+	os.Remove(filePath + SIDECAR_SUFFIX)
+	modified := fileModTime(file)
+	os.Chtimes(filePath, modified, modified)
+	return nil
+}
@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hryyan/b2"
+)
+
+func TestSplitRanges(t *testing.T) {
+	for _, check := range []struct {
+		size, rangeSize int64
+		want            string
+	}{
+		{0, 10, ""},
+		{1, 10, "1:0-0"},
+		{10, 10, "1:0-9"},
+		{11, 10, "1:0-9 2:10-10"},
+		{35, 10, "1:0-9 2:10-19 3:20-29 4:30-34"},
+	} {
+		var got []string
+		for _, r := range splitRanges(check.size, check.rangeSize) {
+			got = append(got, fmt.Sprintf("%d:%d-%d", r.number, r.start, r.end))
+		}
+		if strings.Join(got, " ") != check.want {
+			t.Errorf("splitRanges(%d, %d) = %v, want %s", check.size, check.rangeSize, got, check.want)
+		}
+	}
+}
+
+var testContent = []byte("0123456789abcdefghijABCDEFGHIJklmno")
+
+func testFile() *b2.File {
+	sum := sha1.Sum(testContent)
+	return &b2.File{
+		FileId:        "file0001",
+		FileName:      "app.log",
+		ContentLength: int64(len(testContent)),
+		ContentSha1:   hex.EncodeToString(sum[:]),
+	}
+}
+
+func TestOpenPartial(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "app.log")
+	file := testFile()
+
+	f, d, err := openPartial(file, filePath, 10)
+	if err != nil {
+		t.Fatalf("Open partial failed: %s", err.Error())
+	}
+	f.Close()
+	if info, err := os.Stat(filePath + PART_SUFFIX); err != nil || info.Size() != file.ContentLength {
+		t.Fatalf("Partial file should be preallocated, got %v %v", info, err)
+	}
+	if d.FileId != file.FileId || d.RangeSize != 10 || len(d.Done) != 0 {
+		t.Fatalf("Wrong new sidecar %+v", d)
+	}
+
+	d.Done = []int64{1, 3}
+	if err = d.write(filePath); err != nil {
+		t.Fatal(err)
+	}
+	f, d, err = openPartial(file, filePath, 20)
+	if err != nil {
+		t.Fatalf("Reopen partial failed: %s", err.Error())
+	}
+	f.Close()
+	if d.RangeSize != 10 || len(d.Done) != 2 {
+		t.Fatalf("Sidecar should be resumed with its range size, got %+v", d)
+	}
+
+	for name, change := range map[string]func(){
+		"another version": func() {
+			changed := *d
+			changed.FileId = "file0002"
+			changed.write(filePath)
+		},
+		"another size": func() {
+			changed := *d
+			changed.Size++
+			changed.write(filePath)
+		},
+		"a truncated part": func() {
+			d.write(filePath)
+			os.Truncate(filePath+PART_SUFFIX, 5)
+		},
+		"a broken sidecar": func() {
+			ioutil.WriteFile(filePath+SIDECAR_SUFFIX, []byte("{"), 0644)
+		},
+	} {
+		change()
+		f, restarted, err := openPartial(file, filePath, 20)
+		if err != nil {
+			t.Fatalf("Open partial with %s failed: %s", name, err.Error())
+		}
+		f.Close()
+		if restarted.FileId != file.FileId || restarted.RangeSize != 20 || len(restarted.Done) != 0 {
+			t.Fatalf("Partial with %s should be restarted, got %+v", name, restarted)
+		}
+		if saved := readPartial(filePath); saved == nil || saved.RangeSize != 20 || len(saved.Done) != 0 {
+			t.Fatalf("Sidecar of the restart should be saved, got %+v", saved)
+		}
+	}
+}
+
+// rangeServer serve testContent by id and record the requested ranges.
+type rangeServer struct {
+	mu     sync.Mutex
+	ranges []string
+}
+
+func (s *rangeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasSuffix(r.URL.Path, "/b2_download_file_by_id") || r.URL.Query().Get("fileId") != "file0001" {
+		http.NotFound(w, r)
+		return
+	}
+	s.mu.Lock()
+	s.ranges = append(s.ranges, r.Header.Get("Range"))
+	s.mu.Unlock()
+	http.ServeContent(w, r, "app.log", time.Time{}, bytes.NewReader(testContent))
+}
+
+func TestDownloadRangesResume(t *testing.T) {
+	server := &rangeServer{}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	client := &b2.B2{}
+	client.SetAuth(b2.AuthResponse{
+		AuthorizationToken:      "token",
+		DownloadUrl:             ts.URL,
+		RecommendedPartSize:     10,
+		AbsoluteMinimumPartSize: 10,
+	})
+
+	// ranges 1 and 3 were downloaded by an interrupted attempt
+	filePath := filepath.Join(t.TempDir(), "app.log")
+	file := testFile()
+	f, d, err := openPartial(file, filePath, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteAt(testContent[0:10], 0)
+	f.WriteAt(testContent[20:30], 20)
+	f.Close()
+	d.Done = []int64{1, 3}
+	if err = d.write(filePath); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = downloadRanges(client, file, filePath, 2); err != nil {
+		t.Fatalf("Resume failed: %s", err.Error())
+	}
+
+	sort.Strings(server.ranges)
+	if strings.Join(server.ranges, " ") != "bytes=10-19 bytes=30-34" {
+		t.Fatalf("Only the pending ranges should be downloaded, got %v", server.ranges)
+	}
+	if content, err := ioutil.ReadFile(filePath); err != nil || !bytes.Equal(content, testContent) {
+		t.Fatalf("Wrong downloaded content %q %v", content, err)
+	}
+	for _, suffix := range []string{PART_SUFFIX, SIDECAR_SUFFIX} {
+		if _, err = os.Stat(filePath + suffix); !os.IsNotExist(err) {
+			t.Fatalf("%s should be removed, got %v", suffix, err)
+		}
+	}
+}
@@ -1,5 +1,28 @@
 package cmd
 
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+
+	"github.com/hryyan/b2"
+)
+
+// Exit codes of b2, scripts may rely on them so new ones are only appended.
+//
+//	1-5   the session cache can not be created, read, written, encoded or decoded
+//	6     a local operation failed, such as reading a file
+//	7     wrong arguments, flags or unknown commands
+//	8     the key is wrong or its auth token is rejected
+//	9     any other error returned by b2
+//	10    the bucket or file is not found
+//	11    the key does not have the capability, or is restricted to another bucket or prefix
+//	12    a storage, transaction or download cap of the account is exceeded
+//	13    a network error, timeout or an unavailable service, retrying may succeed
+//	14    the SHA1 of a transferred file does not match
+//	130   interrupted by Ctrl-C while refreshing the session
 const (
 	CREATE_SESSION_ERROR_EXIT = iota + 1
 	READ_SESSION_ERROR_EXIT
@@ -10,4 +33,106 @@ const (
 	WRONG_ARGS_EXIT
 	AUTH_ERROR_EXIT
 	B2_LIBRARY_ERROR_EXIT
+	NOT_FOUND_EXIT
+	PERMISSION_DENIED_EXIT
+	CAP_EXCEEDED_EXIT
+	NETWORK_ERROR_EXIT
+	CHECKSUM_MISMATCH_EXIT
 )
+
+// INTERRUPTED_EXIT is the exit code shells report for a command interrupted by Ctrl-C.
+const INTERRUPTED_EXIT = 130
+
+// b2ExitCodes map the error codes of b2 to exit codes.
+var b2ExitCodes = map[string]int{
+	"bad_auth_token":           AUTH_ERROR_EXIT,
+	"expired_auth_token":       AUTH_ERROR_EXIT,
+	"not_found":                NOT_FOUND_EXIT,
+	"no_such_file":             NOT_FOUND_EXIT,
+	"file_not_present":         NOT_FOUND_EXIT,
+	"unauthorized":             PERMISSION_DENIED_EXIT,
+	"access_denied":            PERMISSION_DENIED_EXIT,
+	"cap_exceeded":             CAP_EXCEEDED_EXIT,
+	"storage_cap_exceeded":     CAP_EXCEEDED_EXIT,
+	"transaction_cap_exceeded": CAP_EXCEEDED_EXIT,
+	"download_cap_exceeded":    CAP_EXCEEDED_EXIT,
+	"too_many_requests":        NETWORK_ERROR_EXIT,
+	"request_timeout":          NETWORK_ERROR_EXIT,
+	"service_unavailable":      NETWORK_ERROR_EXIT,
+	"internal_error":           NETWORK_ERROR_EXIT,
+}
+
+// checksumError is a transferred file whose SHA1 does not match the one recorded in b2.
+type checksumError struct {
+	path     string
+	actual   string
+	expected string
+}
+
+func (e *checksumError) Error() string {
+	return fmt.Sprintf("SHA1 of %s is %s, expected %s!", e.path, e.actual, e.expected)
+}
+
+// exitError is an error returned by a command with the exit code it exits with,
+// unless the error maps to a more specific exit code, see errorExitCode.
+type exitError struct {
+	err      error
+	exitCode int
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+// withExitCode return err exiting with exitCode, nil if err is nil.
+func withExitCode(err error, exitCode int) error {
+	if err == nil {
+		return nil
+	}
+	return &exitError{err: err, exitCode: exitCode}
+}
+
+// errAborted is returned when a confirmation is declined or stdin is closed.
+var errAborted = withExitCode(errors.New("Aborted!"), OPERATION_ERROR_EXIT)
+
+// errorExitCode return the exit code of err, exitCode if err is not a b2, network or checksum error.
+// Wrapped errors map to the exit code of the innermost one which has a code.
+// An unauthorized key exits with AUTH_ERROR_EXIT when it fails to log in.
+func errorExitCode(err error, exitCode int) int {
+	var (
+		withCode    *exitError
+		response    *b2.ErrorResponse
+		checksumErr *checksumError
+		urlErr      *url.Error
+		netErr      net.Error
+	)
+	switch {
+	case errors.As(err, &withCode):
+		return errorExitCode(withCode.err, withCode.exitCode)
+	case errors.As(err, &response):
+		if code, ok := b2ExitCodes[response.Code]; ok {
+			if code == PERMISSION_DENIED_EXIT && exitCode == AUTH_ERROR_EXIT {
+				return AUTH_ERROR_EXIT
+			}
+			return code
+		}
+		switch {
+		case response.Status == 404:
+			return NOT_FOUND_EXIT
+		case response.Status == 403:
+			return PERMISSION_DENIED_EXIT
+		case response.Status == 408 || response.Status == 429 || response.Status >= 500:
+			return NETWORK_ERROR_EXIT
+		}
+		return B2_LIBRARY_ERROR_EXIT
+	case errors.As(err, &checksumErr):
+		return CHECKSUM_MISMATCH_EXIT
+	case errors.As(err, &urlErr), errors.As(err, &netErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return NETWORK_ERROR_EXIT
+	}
+	return exitCode
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/hryyan/b2"
+	"github.com/spf13/cobra"
+)
+
+func TestErrorExitCode(t *testing.T) {
+	notFound := &b2.ErrorResponse{Code: "not_found", Status: 404}
+	for _, check := range []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"a plain error", errors.New("broken"), OPERATION_ERROR_EXIT},
+		{"an error with a code", withExitCode(errors.New("broken"), WRONG_ARGS_EXIT), WRONG_ARGS_EXIT},
+		{"a b2 error", notFound, NOT_FOUND_EXIT},
+		{"a wrapped b2 error", fmt.Errorf("list files: %w", notFound), NOT_FOUND_EXIT},
+		{"a b2 error with a code", withExitCode(fmt.Errorf("list files: %w", notFound), B2_LIBRARY_ERROR_EXIT), NOT_FOUND_EXIT},
+		{"nested codes", withExitCode(withExitCode(errors.New("broken"), AUTH_ERROR_EXIT), OPERATION_ERROR_EXIT), AUTH_ERROR_EXIT},
+		{"an unauthorized login", withExitCode(&b2.ErrorResponse{Code: "unauthorized", Status: 401}, AUTH_ERROR_EXIT), AUTH_ERROR_EXIT},
+		{"a wrapped checksum error", fmt.Errorf("verify: %w", &checksumError{}), CHECKSUM_MISMATCH_EXIT},
+		{"a truncated body", fmt.Errorf("download: %w", io.ErrUnexpectedEOF), NETWORK_ERROR_EXIT},
+	} {
+		if got := errorExitCode(check.err, OPERATION_ERROR_EXIT); got != check.want {
+			t.Errorf("Exit code of %s = %d, want %d", check.name, got, check.want)
+		}
+	}
+
+	if code := b2.ErrorCode(withExitCode(fmt.Errorf("list files: %w", notFound), B2_LIBRARY_ERROR_EXIT)); code != "not_found" {
+		t.Errorf("Wrapped b2 error should keep its code, got %q", code)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	root := &cobra.Command{Use: "b2", SilenceErrors: true}
+	root.SetOut(io.Discard)
+	root.SetErr(io.Discard)
+	root.AddCommand(&cobra.Command{
+		Use:  "fail",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return errors.New("broken")
+		},
+	})
+	runErrors(root)
+
+	for _, check := range []struct {
+		args []string
+		want int
+	}{
+		{[]string{"fail", "x"}, OPERATION_ERROR_EXIT},
+		{[]string{"fail"}, WRONG_ARGS_EXIT},
+		{[]string{"fail", "x", "--unknown"}, WRONG_ARGS_EXIT},
+		{[]string{"unknown"}, WRONG_ARGS_EXIT},
+	} {
+		root.SetArgs(check.args)
+		err := root.Execute()
+		if err == nil {
+			t.Fatalf("%v should fail", check.args)
+		}
+		if got := errorExitCode(err, WRONG_ARGS_EXIT); got != check.want {
+			t.Errorf("Exit code of %v = %d, want %d", check.args, got, check.want)
+		}
+	}
+}
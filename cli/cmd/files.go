@@ -0,0 +1,194 @@
+package cmd
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hryyan/b2"
+)
+
+const LIST_PAGE_SIZE = 1000
+
+// listAll pages through b2_list_file_names, or b2_list_file_versions if versions is true.
+// Folders are returned with the "folder" action if delimiter is not empty.
+func listAll(client *b2.B2, bucketId, prefix, delimiter string, versions bool) ([]*b2.File, error) {
+	var (
+		files         []*b2.File
+		startFileName = ""
+		startFileId   = ""
+	)
+
+	for {
+		if versions {
+			page, err := client.ListFileVersionsPage(bucketId, startFileName, startFileId, prefix, delimiter, LIST_PAGE_SIZE)
+			if err != nil {
+				return nil, withExitCode(err, B2_LIBRARY_ERROR_EXIT)
+			}
+			files = append(files, page.Files...)
+			startFileName, startFileId = page.NextFileName, page.NextFileId
+		} else {
+			page, err := client.ListFileNamesPage(bucketId, startFileName, prefix, delimiter, LIST_PAGE_SIZE)
+			if err != nil {
+				return nil, withExitCode(err, B2_LIBRARY_ERROR_EXIT)
+			}
+			files = append(files, page.Files...)
+			startFileName = page.NextFileName
+		}
+
+		if startFileName == "" {
+			return files, nil
+		}
+	}
+}
+
+// listFiles return the latest uploads under prefix.
+func listFiles(client *b2.B2, bucketId, prefix string) ([]*b2.File, error) {
+	all, err := listAll(client, bucketId, prefix, "", false)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []*b2.File
+	for _, file := range all {
+		if file.Action == "upload" {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+// listVersions return all versions under prefix, versions of a file are newest first.
+func listVersions(client *b2.B2, bucketId, prefix string) ([]*b2.File, error) {
+	return listAll(client, bucketId, prefix, "", true)
+}
+
+// listUnfinished pages through b2_list_unfinished_large_files.
+func listUnfinished(client *b2.B2, bucketId, prefix string) ([]*b2.File, error) {
+	var (
+		files       []*b2.File
+		startFileId = ""
+	)
+
+	for {
+		page, err := client.ListUnfinishedLargeFilesPage(bucketId, prefix, startFileId, 100)
+		if err != nil {
+			return nil, withExitCode(err, B2_LIBRARY_ERROR_EXIT)
+		}
+
+		files = append(files, page.Files...)
+		if page.NextFileId == "" {
+			return files, nil
+		}
+		startFileId = page.NextFileId
+	}
+}
+
+// listParts return all uploaded parts of a large file, ordered by part number.
+func listParts(client *b2.B2, fileId string) ([]*b2.Part, error) {
+	var (
+		parts           []*b2.Part
+		startPartNumber int64 = 1
+	)
+
+	for {
+		page, err := client.ListPartsPage(fileId, startPartNumber, LIST_PAGE_SIZE)
+		if err != nil {
+			return nil, withExitCode(err, B2_LIBRARY_ERROR_EXIT)
+		}
+
+		parts = append(parts, page.Parts...)
+		if page.NextPartNumber == 0 {
+			return parts, nil
+		}
+		startPartNumber = page.NextPartNumber
+	}
+}
+
+// filesAsOf return the version of each file which was current at millis,
+// files hidden or not uploaded yet at that time are left out.
+func filesAsOf(versions []*b2.File, millis int64) []*b2.File {
+	var (
+		files []*b2.File
+		last  = ""
+		found = false
+	)
+
+	for _, version := range versions {
+		if version.FileName != last {
+			last, found = version.FileName, false
+		}
+		if found || version.UploadTimestamp > millis {
+			continue
+		}
+
+		found = true
+		if version.Action == "upload" {
+			files = append(files, version)
+		}
+	}
+	return files
+}
+
+// fileSha1 return the hex SHA1 of a local file.
+func fileSha1(filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha1.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// failuresError return the failures as one error, nil if there is none.
+func failuresError(failures []string) error {
+	if len(failures) == 0 {
+		return nil
+	}
+	return withExitCode(errors.New(strings.Join(failures, "\n")), OPERATION_ERROR_EXIT)
+}
+
+// forEach call fn for items with a pool of workers and return the failures.
+func forEach(workers int64, items []string, fn func(item string) error) []string {
+	var (
+		queue    = make(chan string)
+		pool     sync.WaitGroup
+		mu       sync.Mutex
+		failures []string
+	)
+
+	for i := int64(0); i < workers; i++ {
+		pool.Add(1)
+		go func() {
+			defer pool.Done()
+
+			for item := range queue {
+				if err := fn(item); err != nil {
+					mu.Lock()
+					failures = append(failures, fmt.Sprintf("%s: %s", item, err.Error()))
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	for _, item := range items {
+		queue <- item
+	}
+	close(queue)
+	pool.Wait()
+
+	sort.Strings(failures)
+	return failures
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"fmt"
+	"path"
+)
+
+// fileFilter select files by glob patterns, such as "*.log" or "build/*".
+// A pattern matches a slash separated relative path or its base name,
+// excludes win over includes and no include means all files.
+type fileFilter struct {
+	includes []string
+	excludes []string
+}
+
+func newFileFilter(includes, excludes []string) (*fileFilter, error) {
+	for _, pattern := range append(append([]string{}, includes...), excludes...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, withExitCode(fmt.Errorf("Bad glob pattern %s!", pattern), WRONG_ARGS_EXIT)
+		}
+	}
+	return &fileFilter{includes: includes, excludes: excludes}, nil
+}
+
+func matchGlob(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, path.Base(name)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Excluded report whether name, a file or a directory, matches an exclude pattern.
+func (f *fileFilter) Excluded(name string) bool {
+	return matchGlob(f.excludes, name)
+}
+
+// Match report whether the file name should be selected,
+// files under an excluded directory are not selected.
+func (f *fileFilter) Match(name string) bool {
+	for dir := name; dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if f.Excluded(dir) {
+			return false
+		}
+	}
+	return len(f.includes) == 0 || matchGlob(f.includes, name)
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// isYAML report whether a file name has a YAML extension.
+func isYAML(fileName string) bool {
+	ext := strings.ToLower(filepath.Ext(fileName))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// marshal encode v as JSON, or as YAML with the same keys as JSON if asYAML is true.
+func marshal(v interface{}, asYAML bool) ([]byte, error) {
+	b, err := json.MarshalIndent(v, "", "    ")
+	if err != nil || !asYAML {
+		return b, err
+	}
+
+	var generic interface{}
+	if err = json.Unmarshal(b, &generic); err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(generic)
+}
+
+// unmarshal decode JSON or YAML into v, the keys of YAML are the keys of JSON.
+func unmarshal(b []byte, v interface{}, asYAML bool) error {
+	if !asYAML {
+		return json.Unmarshal(b, v)
+	}
+
+	var generic interface{}
+	if err := yaml.Unmarshal(b, &generic); err != nil {
+		return err
+	}
+	b, err := json.Marshal(generic)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// readConfigFile decode a JSON or YAML file into v by its extension.
+func readConfigFile(fileName string, v interface{}) error {
+	b, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return err
+	}
+	return unmarshal(b, v, isYAML(fileName))
+}
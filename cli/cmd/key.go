@@ -0,0 +1,332 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hryyan/b2"
+	"github.com/spf13/cobra"
+)
+
+const MAX_KEY_TTL = 1000 * 24 * time.Hour
+
+var (
+	keyCapabilities string
+	keyBucket       string
+	keyPrefix       string
+	keyTTL          string
+	keyYes          bool
+)
+
+// listAllKeys pages through b2_list_keys.
+func listAllKeys(client *b2.B2) ([]*b2.ApplicationKey, error) {
+	var (
+		keys    []*b2.ApplicationKey
+		startId = ""
+	)
+
+	for {
+		page, err := client.ListKeys(1000, startId)
+		if err != nil {
+			return nil, withExitCode(err, B2_LIBRARY_ERROR_EXIT)
+		}
+
+		keys = append(keys, page.Keys...)
+		if page.NextApplicationKeyId == "" {
+			return keys, nil
+		}
+		startId = page.NextApplicationKeyId
+	}
+}
+
+// findKey return the key whose id or name is idOrName.
+func findKey(client *b2.B2, idOrName string) (*b2.ApplicationKey, error) {
+	keys, err := listAllKeys(client)
+	if err != nil {
+		return nil, err
+	}
+
+	var found []*b2.ApplicationKey
+	for _, key := range keys {
+		if key.ApplicationKeyId == idOrName {
+			return key, nil
+		}
+		if key.KeyName == idOrName {
+			found = append(found, key)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return nil, withExitCode(fmt.Errorf("Can not find key %s!", idOrName), NOT_FOUND_EXIT)
+	case 1:
+		return found[0], nil
+	default:
+		return nil, withExitCode(fmt.Errorf("%d keys are named %s, please use the key id!", len(found), idOrName), WRONG_ARGS_EXIT)
+	}
+}
+
+// ttlSeconds return a --ttl flag in seconds, 0 if not set.
+func ttlSeconds(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	ttl, err := parseDuration(s)
+	if err != nil {
+		return 0, withExitCode(err, WRONG_ARGS_EXIT)
+	}
+	if ttl < time.Second || ttl > MAX_KEY_TTL {
+		return 0, withExitCode(errors.New("TTL should be between 1s and 1000d!"), WRONG_ARGS_EXIT)
+	}
+	return int64(ttl / time.Second), nil
+}
+
+// remainingSeconds return the seconds left before expiration in milliseconds, at least 1.
+func remainingSeconds(expiration int64) int64 {
+	left := (expiration - time.Now().UnixNano()/int64(time.Millisecond) + 999) / 1000
+	if left < 1 {
+		return 1
+	}
+	return left
+}
+
+// bucketNames map bucket ids to bucket names.
+func bucketNames(client *b2.B2) map[string]string {
+	names := map[string]string{}
+	buckets, err := client.ListBuckets("", "", "")
+	if err != nil {
+		return names
+	}
+	for _, bucket := range buckets {
+		names[bucket.BucketId] = bucket.BucketName
+	}
+	return names
+}
+
+func keyScope(key *b2.ApplicationKey, names map[string]string) string {
+	if key.BucketId == "" {
+		return "*"
+	}
+	name, ok := names[key.BucketId]
+	if !ok {
+		name = key.BucketId
+	}
+	return name + "/" + key.NamePrefix + "*"
+}
+
+func keyExpiry(key *b2.ApplicationKey) string {
+	if key.ExpirationTimestamp == 0 {
+		return "never"
+	}
+	return time.Unix(0, key.ExpirationTimestamp*int64(time.Millisecond)).Format(time.RFC3339)
+}
+
+func printNewKey(key *b2.ApplicationKey) error {
+	return printResult(key, func() {
+		if outputFormat == "plain" {
+			fmt.Printf("%s %s\n", key.ApplicationKeyId, key.ApplicationKey)
+			return
+		}
+		fmt.Printf("keyName:          %s\n", key.KeyName)
+		fmt.Printf("applicationKeyId: %s\n", key.ApplicationKeyId)
+		fmt.Printf("applicationKey:   %s\n", key.ApplicationKey)
+		fmt.Println("The application key is shown only once, keep it safe!")
+	})
+}
+
+var createKeyCmd = &cobra.Command{
+	Use:   "create name",
+	Short: "Create an application key",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		capabilities, err := b2.ParseCapabilities(keyCapabilities)
+		if err != nil {
+			return withExitCode(err, WRONG_ARGS_EXIT)
+		}
+		ttl, err := ttlSeconds(keyTTL)
+		if err != nil {
+			return err
+		}
+
+		client, err := login()
+		if err != nil {
+			return err
+		}
+		spec := &b2.KeySpec{Capabilities: capabilities, NamePrefix: keyPrefix}
+		if keyBucket != "" {
+			bucket, err := getBucket(client, keyBucket)
+			if err != nil {
+				return err
+			}
+			spec.BucketId = bucket.BucketId
+		}
+
+		key, err := client.CreateKeyWithSpec(args[0], ttl, spec)
+		if err != nil {
+			return withExitCode(err, B2_LIBRARY_ERROR_EXIT)
+		}
+
+		return printNewKey(key)
+	},
+}
+
+var listKeysCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List application keys",
+	Args:  cobra.ExactArgs(0),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := login()
+		if err != nil {
+			return err
+		}
+		names := bucketNames(client)
+
+		keys, err := listAllKeys(client)
+		if err != nil {
+			return err
+		}
+		return printResults(keys, func() {
+			for _, key := range keys {
+				if outputFormat == "plain" {
+					fmt.Println(key.ApplicationKeyId)
+					continue
+				}
+
+				capabilities := make([]string, len(key.Capabilities))
+				for i, c := range key.Capabilities {
+					capabilities[i] = string(c)
+				}
+				fmt.Printf("%s %s %s %s %s\n",
+					key.ApplicationKeyId,
+					key.KeyName,
+					keyScope(key, names),
+					keyExpiry(key),
+					strings.Join(capabilities, ","))
+			}
+		})
+	},
+}
+
+var deleteKeyCmd = &cobra.Command{
+	Use:   "delete id|name",
+	Short: "Delete an application key",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := login()
+		if err != nil {
+			return err
+		}
+		key, err := findKey(client, args[0])
+		if err != nil {
+			return err
+		}
+
+		if err = client.DeleteKey(key); err != nil {
+			return withExitCode(err, B2_LIBRARY_ERROR_EXIT)
+		}
+		return printResult(key, func() {
+			fmt.Printf("Delete key %s(%s) successed!\n", key.KeyName, key.ApplicationKeyId)
+		})
+	},
+}
+
+var rotateKeyCmd = &cobra.Command{
+	Use:   "rotate id|name",
+	Short: "Replace an application key by a new key with the same scope",
+	Long: `Replace an application key by a new key with the same scope.
+Without --ttl the new key expires when the old key would.
+The key b2 is logged in with is not deleted, log in with the new key and delete it then.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ttl, err := ttlSeconds(keyTTL)
+		if err != nil {
+			return err
+		}
+
+		client, err := login()
+		if err != nil {
+			return err
+		}
+		old, err := findKey(client, args[0])
+		if err != nil {
+			return err
+		}
+		if ttl == 0 && old.ExpirationTimestamp != 0 {
+			ttl = remainingSeconds(old.ExpirationTimestamp)
+		}
+
+		spec := &b2.KeySpec{
+			Capabilities: old.Capabilities,
+			BucketId:     old.BucketId,
+			NamePrefix:   old.NamePrefix,
+		}
+		key, err := client.CreateKeyWithSpec(old.KeyName, ttl, spec)
+		if err != nil {
+			return withExitCode(err, B2_LIBRARY_ERROR_EXIT)
+		}
+		if err = printNewKey(key); err != nil {
+			return err
+		}
+
+		if old.ApplicationKeyId == client.KeyId {
+			return withExitCode(fmt.Errorf("Can not delete the key %s which is logged in, log in with the new key first!",
+				old.ApplicationKeyId), OPERATION_ERROR_EXIT)
+		}
+		if !keyYes && !confirm(fmt.Sprintf("Delete the old key %s?", old.ApplicationKeyId)) {
+			fmt.Fprintf(messageOutput(), "Keep the old key %s.\n", old.ApplicationKeyId)
+			return errAborted
+		}
+
+		if err = client.DeleteKey(old); err != nil {
+			return withExitCode(err, B2_LIBRARY_ERROR_EXIT)
+		}
+		fmt.Fprintf(messageOutput(), "Delete key %s successed!\n", old.ApplicationKeyId)
+		return nil
+	},
+}
+
+var keyCmd = &cobra.Command{
+	Use:   "key command",
+	Short: "Manage application keys",
+}
+
+func init() {
+	createKeyCmd.Flags().StringVar(
+		&keyCapabilities,
+		"cap",
+		"",
+		"comma separated capabilities, such as readFiles,listFiles")
+	createKeyCmd.Flags().StringVar(
+		&keyBucket,
+		"bucket",
+		"",
+		"restrict the key to a bucket")
+	createKeyCmd.Flags().StringVar(
+		&keyPrefix,
+		"prefix",
+		"",
+		"restrict the key to file names with the prefix")
+	createKeyCmd.MarkFlagRequired("cap")
+
+	for _, cmd := range []*cobra.Command{createKeyCmd, rotateKeyCmd} {
+		cmd.Flags().StringVar(
+			&keyTTL,
+			"ttl",
+			"",
+			"valid duration of the key, such as 12h or 7d")
+	}
+
+	rotateKeyCmd.Flags().BoolVarP(
+		&keyYes,
+		"yes",
+		"y",
+		false,
+		"delete the old key without confirmation")
+
+	keyCmd.AddCommand(createKeyCmd, listKeysCmd, deleteKeyCmd, rotateKeyCmd)
+
+	rootCmd.AddCommand(keyCmd)
+}
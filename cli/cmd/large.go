@@ -0,0 +1,243 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/hryyan/b2"
+	"github.com/spf13/cobra"
+)
+
+var (
+	largePrefix    string
+	largeOlderThan string
+	largeDryRun    bool
+	largeYes       bool
+)
+
+// unfinishedFile is an unfinished large file with the number and size of its uploaded parts.
+type unfinishedFile struct {
+	*b2.File
+	Parts         int   `json:"parts"`
+	UploadedBytes int64 `json:"uploadedBytes"`
+}
+
+var listLargeCmd = &cobra.Command{
+	Use:   "list bucket",
+	Short: "List unfinished large files with their uploaded parts",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, bucket, err := loginBucket(args[0])
+		if err != nil {
+			return err
+		}
+		files, err := listUnfinished(client, bucket.BucketId, largePrefix)
+		if err != nil {
+			return err
+		}
+
+		unfinished := make([]*unfinishedFile, 0, len(files))
+		for _, file := range files {
+			parts, err := listParts(client, file.FileId)
+			if err != nil {
+				return err
+			}
+			u := &unfinishedFile{File: file, Parts: len(parts)}
+			for _, part := range parts {
+				u.UploadedBytes += part.ContentLength
+			}
+			unfinished = append(unfinished, u)
+		}
+
+		return printResults(unfinished, func() {
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			for _, u := range unfinished {
+				fmt.Fprintf(w, "%s\t%s\t%d parts\t%s\t%s\n",
+					u.FileName, formatMillis(u.UploadTimestamp), u.Parts, humanSize(u.UploadedBytes), u.FileId)
+			}
+			w.Flush()
+		})
+	},
+}
+
+var partsLargeCmd = &cobra.Command{
+	Use:   "parts fileId",
+	Short: "List the uploaded parts of an unfinished large file",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := login()
+		if err != nil {
+			return err
+		}
+		parts, err := listParts(client, args[0])
+		if err != nil {
+			return err
+		}
+
+		return printResults(parts, func() {
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			for _, part := range parts {
+				fmt.Fprintf(w, "%d\t%s\t%s\t%s\n",
+					part.PartNumber, humanSize(part.ContentLength), formatMillis(part.UploadTimestamp), part.ContentSha1)
+			}
+			w.Flush()
+		})
+	},
+}
+
+var cancelLargeCmd = &cobra.Command{
+	Use:   "cancel bucket [fileId ..]",
+	Short: "Cancel unfinished large files and delete their parts",
+	Long: `Cancel the unfinished large files of a bucket, or only the given ones,
+which match --prefix and were started before --older-than.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var before int64
+		if largeOlderThan != "" {
+			olderThan, err := parseDuration(largeOlderThan)
+			if err != nil {
+				return withExitCode(err, WRONG_ARGS_EXIT)
+			}
+			before = time.Now().Add(-olderThan).UnixNano() / int64(time.Millisecond)
+		}
+		if concurrency < 1 {
+			concurrency = 1
+		}
+
+		client, bucket, err := loginBucket(args[0])
+		if err != nil {
+			return err
+		}
+		unfinished, err := listUnfinished(client, bucket.BucketId, largePrefix)
+		if err != nil {
+			return err
+		}
+
+		wanted := map[string]bool{}
+		for _, fileId := range args[1:] {
+			wanted[fileId] = true
+		}
+
+		var (
+			files   = map[string]*b2.File{}
+			fileIds []string
+		)
+		for _, file := range unfinished {
+			if (len(wanted) > 0 && !wanted[file.FileId]) ||
+				(before > 0 && file.UploadTimestamp >= before) {
+				continue
+			}
+			files[file.FileId] = file
+			fileIds = append(fileIds, file.FileId)
+		}
+		sort.Strings(fileIds)
+
+		if largeDryRun {
+			for _, fileId := range fileIds {
+				fmt.Fprintf(messageOutput(), "cancel %s (%s)\n", files[fileId].FileName, fileId)
+			}
+			fmt.Fprintf(messageOutput(), "Dry run, %d files to cancel.\n", len(fileIds))
+			return nil
+		}
+
+		if len(fileIds) == 0 {
+			fmt.Fprintln(messageOutput(), "No unfinished large files matched.")
+			return nil
+		}
+		if !largeYes &&
+			!confirm(fmt.Sprintf("Going to cancel %d unfinished large files in %s, continue?", len(fileIds), bucket.BucketName)) {
+			return errAborted
+		}
+
+		failures := forEach(concurrency, fileIds, func(fileId string) error {
+			err := client.CancelLargeFile(fileId)
+			if err == nil {
+				fmt.Fprintf(messageOutput(), "cancel %s (%s)\n", files[fileId].FileName, fileId)
+			}
+			return err
+		})
+
+		fmt.Fprintf(messageOutput(), "Done, %d files, %d failed.\n", len(fileIds)-len(failures), len(failures))
+		return failuresError(failures)
+	},
+}
+
+var finishLargeCmd = &cobra.Command{
+	Use:   "finish fileId",
+	Short: "Finish an unfinished large file whose parts are all uploaded",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := login()
+		if err != nil {
+			return err
+		}
+
+		parts, err := listParts(client, args[0])
+		if err != nil {
+			return err
+		}
+		if len(parts) == 0 {
+			return withExitCode(fmt.Errorf("No parts uploaded for %s!", args[0]), OPERATION_ERROR_EXIT)
+		}
+
+		sha1s := make([]string, len(parts))
+		for i, part := range parts {
+			if part.PartNumber != int64(i+1) {
+				return withExitCode(fmt.Errorf("Part %d of %s is missing, upload it before finishing!", i+1, args[0]), OPERATION_ERROR_EXIT)
+			}
+			sha1s[i] = part.ContentSha1
+		}
+
+		file, err := client.FinishLargeFile(args[0], sha1s)
+		if err != nil {
+			return withExitCode(err, B2_LIBRARY_ERROR_EXIT)
+		}
+		fmt.Fprintf(messageOutput(), "Finish %s with %d parts successed!\n", file.FileName, len(parts))
+		return nil
+	},
+}
+
+var largeCmd = &cobra.Command{
+	Use:   "large command",
+	Short: "Inspect, cancel or finish unfinished large files",
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{listLargeCmd, cancelLargeCmd} {
+		cmd.Flags().StringVar(
+			&largePrefix,
+			"prefix",
+			"",
+			"only files with the prefix")
+	}
+
+	cancelLargeCmd.Flags().StringVar(
+		&largeOlderThan,
+		"older-than",
+		"",
+		"only files started before this duration, such as 7d")
+	cancelLargeCmd.Flags().BoolVar(
+		&largeDryRun,
+		"dry-run",
+		false,
+		"print the matched files only")
+	cancelLargeCmd.Flags().BoolVarP(
+		&largeYes,
+		"yes",
+		"y",
+		false,
+		"do not ask for confirmation")
+	cancelLargeCmd.Flags().Int64VarP(
+		&concurrency,
+		"concurrency",
+		"c",
+		1,
+		"threads for canceling")
+
+	largeCmd.AddCommand(listLargeCmd, partsLargeCmd, cancelLargeCmd, finishLargeCmd)
+
+	rootCmd.AddCommand(largeCmd)
+}
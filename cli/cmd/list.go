@@ -2,7 +2,6 @@ package cmd
 
 import (
 	"fmt"
-	"os"
 
 	"github.com/fatih/color"
 	"github.com/hryyan/b2"
@@ -13,23 +12,30 @@ var listBucketsCmd = &cobra.Command{
 	Use:   "buckets",
 	Short: "List buckets",
 	Args:  cobra.ExactArgs(0),
-	Run: func(cmd *cobra.Command, args []string) {
-		client := login()
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := login()
+		if err != nil {
+			return err
+		}
 		buckets, err := client.ListBuckets("", "", "")
 		if err != nil {
-			fmt.Println(err.Error())
-			os.Exit(B2_LIBRARY_ERROR_EXIT)
+			return withExitCode(err, B2_LIBRARY_ERROR_EXIT)
 		}
-		green := color.New(color.FgGreen).PrintfFunc()
-		white := color.New(color.FgWhite).PrintfFunc()
+		return printResults(buckets, func() {
+			if outputFormat == "plain" {
+				color.NoColor = true
+			}
+			green := color.New(color.FgGreen).PrintfFunc()
+			white := color.New(color.FgWhite).PrintfFunc()
 
-		for _, bucket := range buckets {
-			if bucket.BucketType == b2.PUBLIC {
-				green("%s\n", bucket.BucketName)
-			} else {
-				white("%s\n", bucket.BucketName)
+			for _, bucket := range buckets {
+				if bucket.BucketType == b2.PUBLIC {
+					green("%s\n", bucket.BucketName)
+				} else {
+					white("%s\n", bucket.BucketName)
+				}
 			}
-		}
+		})
 	},
 }
 
@@ -37,30 +43,26 @@ var listFilesCmd = &cobra.Command{
 	Use:   "files",
 	Short: "List file",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		client := login()
-		bucketName := args[0]
-		buckets, err := client.ListBuckets("", bucketName, "")
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, bucket, err := loginBucket(args[0])
 		if err != nil {
-			fmt.Println(err.Error())
-			os.Exit(B2_LIBRARY_ERROR_EXIT)
+			return err
 		}
 
-		if len(buckets) != 1 {
-			fmt.Printf("Can not find bucket %s!\n", bucketName)
-			os.Exit(OPERATION_ERROR_EXIT)
-		}
-
-		bucket := buckets[0]
 		files, err := client.ListFileNames(bucket.BucketId, "", "", "", 10000)
 		if err != nil {
-			fmt.Println(err.Error())
-			os.Exit(B2_LIBRARY_ERROR_EXIT)
+			return withExitCode(err, B2_LIBRARY_ERROR_EXIT)
 		}
 
-		for _, file := range files {
-			fmt.Printf("%s %d %s\n", file.FileName, file.ContentLength, file.ContentType)
-		}
+		return printResults(files, func() {
+			for _, file := range files {
+				if outputFormat == "plain" {
+					fmt.Println(file.FileName)
+				} else {
+					fmt.Printf("%s %d %s\n", file.FileName, file.ContentLength, file.ContentType)
+				}
+			}
+		})
 	},
 }
 
@@ -0,0 +1,194 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/hryyan/b2"
+	"github.com/spf13/cobra"
+)
+
+var (
+	lsRecursive bool
+	lsLong      bool
+	lsVersions  bool
+	lsSort      string
+	lsReverse   bool
+)
+
+// lsEntry is a file, a file version or a folder printed by "ls".
+type lsEntry struct {
+	Name         string `json:"name"`
+	Action       string `json:"action"`
+	Size         int64  `json:"size"`
+	UploadTime   string `json:"uploadTime,omitempty"`
+	FileId       string `json:"fileId,omitempty"`
+	Sha1         string `json:"sha1,omitempty"`
+	ContentType  string `json:"contentType,omitempty"`
+	uploadMillis int64
+}
+
+func newLsEntry(file *b2.File) *lsEntry {
+	entry := &lsEntry{
+		Name:         file.FileName,
+		Action:       file.Action,
+		Size:         file.ContentLength,
+		FileId:       file.FileId,
+		Sha1:         file.Sha1(),
+		ContentType:  file.ContentType,
+		uploadMillis: file.UploadTimestamp,
+	}
+	if file.UploadTimestamp > 0 {
+		entry.UploadTime = time.Unix(0, file.UploadTimestamp*int64(time.Millisecond)).Format(time.RFC3339)
+	}
+	return entry
+}
+
+// splitBucketPath split "bucket/prefix" into the bucket name and the prefix.
+func splitBucketPath(s string) (string, string) {
+	s = strings.TrimPrefix(s, B2_SCHEME)
+	parts := strings.SplitN(s, "/", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
+func sortLsEntries(entries []*lsEntry) {
+	var less func(i, j int) bool
+	switch lsSort {
+	case "size":
+		less = func(i, j int) bool { return entries[i].Size < entries[j].Size }
+	case "time":
+		less = func(i, j int) bool { return entries[i].uploadMillis < entries[j].uploadMillis }
+	default:
+		less = func(i, j int) bool { return entries[i].Name < entries[j].Name }
+	}
+
+	if lsReverse {
+		sort.SliceStable(entries, func(i, j int) bool { return less(j, i) })
+	} else {
+		sort.SliceStable(entries, less)
+	}
+}
+
+func printLsTable(entries []*lsEntry) {
+	if !lsLong || outputFormat == "plain" {
+		for _, entry := range entries {
+			fmt.Println(entry.Name)
+		}
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, entry := range entries {
+		if entry.Action == "folder" {
+			fmt.Fprintf(w, "%s\t-\t-\t-\t-\t%s\n", entry.Action, entry.Name)
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			entry.Action, humanSize(entry.Size), entry.UploadTime, entry.FileId, entry.Sha1, entry.Name)
+	}
+	w.Flush()
+}
+
+func printLsCSV(entries []*lsEntry) {
+	w := csv.NewWriter(os.Stdout)
+	w.Write([]string{"name", "action", "size", "uploadTime", "fileId", "sha1", "contentType"})
+	for _, entry := range entries {
+		w.Write([]string{
+			entry.Name,
+			entry.Action,
+			strconv.FormatInt(entry.Size, 10),
+			entry.UploadTime,
+			entry.FileId,
+			entry.Sha1,
+			entry.ContentType,
+		})
+	}
+	w.Flush()
+}
+
+var lsCmd = &cobra.Command{
+	Use:   "ls bucket[/prefix]",
+	Short: "List files and folders under a prefix",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		switch lsSort {
+		case "name", "size", "time":
+		default:
+			return withExitCode(errors.New("--sort should be one of name, size, time!"), WRONG_ARGS_EXIT)
+		}
+
+		bucketName, prefix := splitBucketPath(args[0])
+		delimiter := "/"
+		if lsRecursive {
+			delimiter = ""
+		}
+
+		client, bucket, err := loginBucket(bucketName)
+		if err != nil {
+			return err
+		}
+		files, err := listAll(client, bucket.BucketId, prefix, delimiter, lsVersions)
+		if err != nil {
+			return err
+		}
+
+		var entries []*lsEntry
+		for _, file := range files {
+			if !lsVersions && file.Action != "upload" && file.Action != "folder" {
+				continue
+			}
+			entries = append(entries, newLsEntry(file))
+		}
+		sortLsEntries(entries)
+
+		if outputFormat == "csv" {
+			printLsCSV(entries)
+			return nil
+		}
+		return printResults(entries, func() {
+			printLsTable(entries)
+		})
+	},
+}
+
+func init() {
+	lsCmd.Flags().BoolVarP(
+		&lsRecursive,
+		"recursive",
+		"r",
+		false,
+		"list files in all folders under the prefix")
+	lsCmd.Flags().BoolVarP(
+		&lsLong,
+		"long",
+		"l",
+		false,
+		"show action, size, upload time, file id and sha1")
+	lsCmd.Flags().BoolVar(
+		&lsVersions,
+		"versions",
+		false,
+		"list all versions, including hidden files")
+	lsCmd.Flags().StringVar(
+		&lsSort,
+		"sort",
+		"name",
+		"sort by name, size or time")
+	lsCmd.Flags().BoolVar(
+		&lsReverse,
+		"reverse",
+		false,
+		"reverse the sort order")
+
+	rootCmd.AddCommand(lsCmd)
+}
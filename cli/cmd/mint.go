@@ -0,0 +1,308 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hryyan/b2"
+	"github.com/spf13/cobra"
+)
+
+// mintPurposes map a purpose to the minimal capabilities it needs.
+var mintPurposes = map[string][]b2.Capability{
+	"upload":   {b2.LIST_BUCKETS, b2.WRITE_FILES},
+	"download": {b2.LIST_BUCKETS, b2.READ_FILES},
+	"read":     {b2.LIST_BUCKETS, b2.LIST_FILES, b2.READ_FILES},
+	"share":    {b2.LIST_BUCKETS, b2.LIST_FILES, b2.SHARE_FILES},
+	"delete":   {b2.LIST_BUCKETS, b2.LIST_FILES, b2.DELETE_FILES},
+	"sync":     {b2.LIST_BUCKETS, b2.LIST_FILES, b2.READ_FILES, b2.WRITE_FILES, b2.DELETE_FILES},
+}
+
+var (
+	mintFor         string
+	mintFormat      string
+	mintTTL         string
+	mintGcAll       bool
+	mintGcOlderThan string
+)
+
+// MintedKey is a key recorded by "key mint", ExpiresAt is 0 if it was minted without --ttl.
+type MintedKey struct {
+	ApplicationKeyId string `json:"applicationKeyId"`
+	KeyName          string `json:"keyName"`
+	AccountId        string `json:"accountId"`
+	Purpose          string `json:"purpose"`
+	BucketName       string `json:"bucketName,omitempty"`
+	NamePrefix       string `json:"namePrefix,omitempty"`
+	CreatedAt        int64  `json:"createdAt"`
+	ExpiresAt        int64  `json:"expiresAt,omitempty"`
+}
+
+// configDir return the directory of b2 configurations, such as ~/.config/b2.
+func configDir() string {
+	return filepath.Dir(b2.DefaultCredentialsPath())
+}
+
+func mintedKeysPath() string {
+	return filepath.Join(configDir(), "minted_keys.json")
+}
+
+func readMintedKeys() ([]*MintedKey, error) {
+	var keys []*MintedKey
+	b, err := ioutil.ReadFile(mintedKeysPath())
+	if os.IsNotExist(err) {
+		return keys, nil
+	} else if err != nil {
+		return nil, withExitCode(err, OPERATION_ERROR_EXIT)
+	}
+
+	if err = json.Unmarshal(b, &keys); err != nil {
+		return nil, withExitCode(fmt.Errorf("Decode %s error!", mintedKeysPath()), OPERATION_ERROR_EXIT)
+	}
+	return keys, nil
+}
+
+func writeMintedKeys(keys []*MintedKey) error {
+	b, err := json.MarshalIndent(keys, "", "    ")
+	if err != nil {
+		return withExitCode(err, OPERATION_ERROR_EXIT)
+	}
+
+	if err = os.MkdirAll(configDir(), 0700); err != nil {
+		return withExitCode(err, OPERATION_ERROR_EXIT)
+	}
+	if err = ioutil.WriteFile(mintedKeysPath(), b, 0600); err != nil {
+		return withExitCode(err, OPERATION_ERROR_EXIT)
+	}
+	return nil
+}
+
+// updateMintedKeys replace the minted keys by update of them, locked against other b2 processes.
+func updateMintedKeys(update func(keys []*MintedKey) []*MintedKey) error {
+	if err := os.MkdirAll(configDir(), 0700); err != nil {
+		return withExitCode(err, OPERATION_ERROR_EXIT)
+	}
+	unlock, err := lockFile(mintedKeysPath()+".lock", SESSION_LOCK_TIMEOUT)
+	if err != nil {
+		return withExitCode(err, OPERATION_ERROR_EXIT)
+	}
+	defer unlock()
+
+	keys, err := readMintedKeys()
+	if err != nil {
+		return err
+	}
+	return writeMintedKeys(update(keys))
+}
+
+func printMintedKey(key *b2.ApplicationKey, format string) error {
+	switch format {
+	case "env":
+		fmt.Fprintf(messageOutput(), "export B2_APPLICATION_KEY_ID=%s\n", key.ApplicationKeyId)
+		fmt.Fprintf(messageOutput(), "export B2_APPLICATION_KEY=%s\n", key.ApplicationKey)
+	case "dotenv":
+		fmt.Fprintf(messageOutput(), "B2_APPLICATION_KEY_ID=%s\n", key.ApplicationKeyId)
+		fmt.Fprintf(messageOutput(), "B2_APPLICATION_KEY=%s\n", key.ApplicationKey)
+	case "json":
+		b, err := json.MarshalIndent(key, "", "    ")
+		if err != nil {
+			return withExitCode(err, OPERATION_ERROR_EXIT)
+		}
+		fmt.Fprintln(messageOutput(), string(b))
+	}
+	return nil
+}
+
+var mintKeyCmd = &cobra.Command{
+	Use:   "mint",
+	Short: "Mint a short-lived key with the minimal capabilities for a job",
+	Args:  cobra.ExactArgs(0),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		capabilities, ok := mintPurposes[mintFor]
+		if !ok {
+			purposes := make([]string, 0, len(mintPurposes))
+			for purpose := range mintPurposes {
+				purposes = append(purposes, purpose)
+			}
+			sort.Strings(purposes)
+			return withExitCode(fmt.Errorf("--for should be one of %s!", strings.Join(purposes, ", ")), WRONG_ARGS_EXIT)
+		}
+
+		if mintFormat != "env" && mintFormat != "dotenv" && mintFormat != "json" {
+			return withExitCode(errors.New("--format should be one of env, dotenv, json!"), WRONG_ARGS_EXIT)
+		}
+
+		ttl, err := ttlSeconds(mintTTL)
+		if err != nil {
+			return err
+		}
+		client, bucket, err := loginBucket(keyBucket)
+		if err != nil {
+			return err
+		}
+
+		spec := &b2.KeySpec{
+			Capabilities: capabilities,
+			BucketId:     bucket.BucketId,
+			NamePrefix:   keyPrefix,
+		}
+		now := time.Now()
+		keyName := fmt.Sprintf("mint-%s-%d", mintFor, now.Unix())
+		key, err := client.CreateKeyWithSpec(keyName, ttl, spec)
+		if err != nil {
+			return withExitCode(err, B2_LIBRARY_ERROR_EXIT)
+		}
+
+		mintedKey := &MintedKey{
+			ApplicationKeyId: key.ApplicationKeyId,
+			KeyName:          key.KeyName,
+			AccountId:        client.GetAuth().AccountId,
+			Purpose:          mintFor,
+			BucketName:       bucket.BucketName,
+			NamePrefix:       keyPrefix,
+			CreatedAt:        now.Unix(),
+		}
+		if ttl > 0 {
+			mintedKey.ExpiresAt = now.Unix() + ttl
+		}
+		err = updateMintedKeys(func(keys []*MintedKey) []*MintedKey {
+			return append(keys, mintedKey)
+		})
+		if err != nil {
+			// an unrecorded key would never be collected by gc
+			if deleteErr := client.DeleteKey(key); deleteErr != nil {
+				return withExitCode(fmt.Errorf("%s, and the key %s can not be deleted: %s",
+					err.Error(), key.ApplicationKeyId, deleteErr.Error()), OPERATION_ERROR_EXIT)
+			}
+			return err
+		}
+
+		return printMintedKey(key, mintFormat)
+	},
+}
+
+var gcKeyCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Delete minted keys which have expired or outlived --older-than",
+	Args:  cobra.ExactArgs(0),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var olderThan time.Duration
+		if mintGcOlderThan != "" {
+			var err error
+			if olderThan, err = parseDuration(mintGcOlderThan); err != nil {
+				return withExitCode(err, WRONG_ARGS_EXIT)
+			}
+		}
+
+		client, err := login()
+		if err != nil {
+			return err
+		}
+		keys, err := listAllKeys(client)
+		if err != nil {
+			return err
+		}
+		minted, err := readMintedKeys()
+		if err != nil {
+			return err
+		}
+
+		accountId := client.GetAuth().AccountId
+		existing := map[string]*b2.ApplicationKey{}
+		for _, key := range keys {
+			existing[key.ApplicationKeyId] = key
+		}
+
+		var (
+			now     = time.Now()
+			dropped = map[string]bool{}
+		)
+		for _, minted := range minted {
+			if minted.AccountId != accountId {
+				continue
+			}
+
+			key, ok := existing[minted.ApplicationKeyId]
+			if !ok {
+				// expired or deleted elsewhere
+				dropped[minted.ApplicationKeyId] = true
+				continue
+			}
+
+			outlived := mintGcAll ||
+				(minted.ExpiresAt != 0 && now.Unix() >= minted.ExpiresAt) ||
+				(olderThan > 0 && now.Sub(time.Unix(minted.CreatedAt, 0)) > olderThan)
+			if !outlived {
+				continue
+			}
+
+			if err := client.DeleteKey(key); err != nil {
+				fmt.Fprintln(messageOutput(), err.Error())
+				continue
+			}
+			dropped[minted.ApplicationKeyId] = true
+			fmt.Fprintf(messageOutput(), "Delete minted key %s(%s) successed!\n", minted.KeyName, minted.ApplicationKeyId)
+		}
+
+		// keys minted by other b2 processes meanwhile are kept
+		return updateMintedKeys(func(keys []*MintedKey) []*MintedKey {
+			var kept []*MintedKey
+			for _, key := range keys {
+				if !dropped[key.ApplicationKeyId] {
+					kept = append(kept, key)
+				}
+			}
+			return kept
+		})
+	},
+}
+
+func init() {
+	mintKeyCmd.Flags().StringVar(
+		&mintFor,
+		"for",
+		"",
+		"purpose of the key: upload, download, read, share, delete or sync")
+	mintKeyCmd.Flags().StringVar(
+		&keyBucket,
+		"bucket",
+		"",
+		"bucket the key is restricted to")
+	mintKeyCmd.Flags().StringVar(
+		&keyPrefix,
+		"prefix",
+		"",
+		"restrict the key to file names with the prefix")
+	mintKeyCmd.Flags().StringVar(
+		&mintTTL,
+		"ttl",
+		"1h",
+		"valid duration of the key, such as 1h or 7d")
+	mintKeyCmd.Flags().StringVar(
+		&mintFormat,
+		"format",
+		"env",
+		"output format: env, dotenv or json")
+	mintKeyCmd.MarkFlagRequired("for")
+	mintKeyCmd.MarkFlagRequired("bucket")
+
+	gcKeyCmd.Flags().StringVar(
+		&mintGcOlderThan,
+		"older-than",
+		"",
+		"also delete minted keys created before this duration, such as 2h")
+	gcKeyCmd.Flags().BoolVar(
+		&mintGcAll,
+		"all",
+		false,
+		"delete all minted keys")
+
+	keyCmd.AddCommand(mintKeyCmd, gcKeyCmd)
+}
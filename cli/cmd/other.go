@@ -2,7 +2,6 @@ package cmd
 
 import (
 	"fmt"
-	"os"
 	"os/exec"
 	"runtime"
 
@@ -14,33 +13,36 @@ var publicBucketCmd = &cobra.Command{
 	Use:   "public [bucket ..]",
 	Short: "Public bucket",
 	Args:  cobra.MinimumNArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		client := login()
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := login()
+		if err != nil {
+			return err
+		}
 		buckets, err := client.ListBuckets("", "", "")
 		if err != nil {
-			fmt.Println(err.Error())
-			os.Exit(B2_LIBRARY_ERROR_EXIT)
+			return withExitCode(err, B2_LIBRARY_ERROR_EXIT)
 		}
 
+		var updated []*b2.Bucket
 		for _, name := range args {
 			found := false
 			for _, bucket := range buckets {
 				if name == bucket.BucketName {
 					found = true
 					bucket.BucketType = b2.PUBLIC
-					_, err := client.UpdateBucket(bucket, false)
+					bucket, err := client.UpdateBucket(bucket, false)
 					if err != nil {
-						fmt.Println(err.Error())
-						os.Exit(B2_LIBRARY_ERROR_EXIT)
+						return withExitCode(err, B2_LIBRARY_ERROR_EXIT)
 					}
+					updated = append(updated, bucket)
 				}
 			}
 
 			if !found {
-				fmt.Printf("Can not find bucket %s!\n", name)
-				os.Exit(OPERATION_ERROR_EXIT)
+				return withExitCode(fmt.Errorf("Can not find bucket %s!", name), NOT_FOUND_EXIT)
 			}
 		}
+		return printResults(updated, nil)
 	},
 }
 
@@ -48,81 +50,70 @@ var privateBucket = &cobra.Command{
 	Use:   "private [bucket ..]",
 	Short: "Private bucket",
 	Args:  cobra.MinimumNArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		client := login()
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := login()
+		if err != nil {
+			return err
+		}
 		buckets, err := client.ListBuckets("", "", "")
 		if err != nil {
-			fmt.Println(err.Error())
-			os.Exit(B2_LIBRARY_ERROR_EXIT)
+			return withExitCode(err, B2_LIBRARY_ERROR_EXIT)
 		}
 
+		var updated []*b2.Bucket
 		for _, name := range args {
 			found := false
 			for _, bucket := range buckets {
 				if name == bucket.BucketName {
 					found = true
 					bucket.BucketType = b2.PRIVATE
-					_, err := client.UpdateBucket(bucket, false)
+					bucket, err := client.UpdateBucket(bucket, false)
 					if err != nil {
-						fmt.Println(err.Error())
-						os.Exit(OPERATION_ERROR_EXIT)
-					} else {
-						fmt.Printf("Private bucket %s successed!\n", name)
+						return withExitCode(err, B2_LIBRARY_ERROR_EXIT)
 					}
+					updated = append(updated, bucket)
 				}
 			}
 
 			if !found {
-				fmt.Printf("Can not find bucket %s!\n", name)
-				os.Exit(OPERATION_ERROR_EXIT)
+				return withExitCode(fmt.Errorf("Can not find bucket %s!", name), NOT_FOUND_EXIT)
 			}
 		}
+		return printResults(updated, func() {
+			for _, bucket := range updated {
+				fmt.Printf("Private bucket %s successed!\n", bucket.BucketName)
+			}
+		})
 	},
 }
 
 var flushAllUnfinishPartCmd = &cobra.Command{
-	Use:   "flush [bucket..]",
-	Short: "Flush all unfinished part",
-	Args:  cobra.MinimumNArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		client := login()
-
-		buckets, err := client.ListBuckets("", "", "")
+	Use:        "flush [bucket..]",
+	Short:      "Flush all unfinished part",
+	Deprecated: `use "large cancel" instead`,
+	Args:       cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := login()
 		if err != nil {
-			fmt.Println(err.Error())
-			os.Exit(B2_LIBRARY_ERROR_EXIT)
+			return err
 		}
 
 		for _, name := range args {
-			found := false
-			for _, bucket := range buckets {
-				if name == bucket.BucketName {
-					found = true
-					files, err := client.ListUnfinishedLargeFiles(
-						bucket.BucketId,
-						"",
-						"",
-						100,
-					)
-					if err != nil {
-						fmt.Println(err.Error())
-						os.Exit(B2_LIBRARY_ERROR_EXIT)
-					}
-
-					for _, file := range files {
-						err = client.CancelLargeFile(file.FileId)
-						if err != nil {
-							fmt.Println(err.Error())
-							os.Exit(B2_LIBRARY_ERROR_EXIT)
-						}
-					}
-				}
+			bucket, err := getBucket(client, name)
+			if err != nil {
+				return err
 			}
-			if !found {
-				fmt.Printf("Can not find bucket %s!\n", name)
-				os.Exit(OPERATION_ERROR_EXIT)
+			files, err := listUnfinished(client, bucket.BucketId, "")
+			if err != nil {
+				return err
+			}
+			for _, file := range files {
+				if err := client.CancelLargeFile(file.FileId); err != nil {
+					return withExitCode(err, B2_LIBRARY_ERROR_EXIT)
+				}
 			}
 		}
+		return nil
 	},
 }
 
@@ -132,8 +123,11 @@ var newBucketCmd = &cobra.Command{
 	Use:   "bucket [bucket ..]",
 	Short: "New bucket",
 	Args:  cobra.MinimumNArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		client := login()
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := login()
+		if err != nil {
+			return err
+		}
 		bucketType := ""
 
 		if public {
@@ -142,14 +136,16 @@ var newBucketCmd = &cobra.Command{
 			bucketType = b2.PRIVATE
 		}
 
+		var created []*b2.Bucket
 		for _, name := range args {
-			_, err := client.CreateBucket(name, bucketType,
+			bucket, err := client.CreateBucket(name, bucketType,
 				map[string]string{}, []b2.CorsRule{}, []b2.LifecycleRule{})
 			if err != nil {
-				fmt.Println(err.Error())
-				os.Exit(OPERATION_ERROR_EXIT)
+				return withExitCode(err, OPERATION_ERROR_EXIT)
 			}
+			created = append(created, bucket)
 		}
+		return printResults(created, nil)
 	},
 }
 
@@ -161,13 +157,14 @@ var newCmd = &cobra.Command{
 var registerCmd = &cobra.Command{
 	Use:   "register",
 	Short: "register a b2 account",
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		if runtime.GOOS == "darwin" {
 			cmd := exec.Command("open", "https://www.backblaze.com/b2/sign-up.html")
 			cmd.Run()
 		} else {
-			fmt.Println("https://www.backblaze.com/b2/sign-up.html")
+			fmt.Fprintln(messageOutput(), "https://www.backblaze.com/b2/sign-up.html")
 		}
+		return nil
 	},
 }
 
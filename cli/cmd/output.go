@@ -0,0 +1,226 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hryyan/b2"
+	"github.com/spf13/cobra"
+	"github.com/vbauerster/mpb"
+)
+
+// PROGRESS_INTERVAL is the least interval between two JSON progress events of a transfer.
+const PROGRESS_INTERVAL = time.Second
+
+var outputFormat string
+
+var outputFormats = []string{"table", "plain", "json", "jsonl", "csv"}
+
+// exitCodeNames name the exit codes in JSON errors.
+var exitCodeNames = map[int]string{
+	CREATE_SESSION_ERROR_EXIT: "create_session_error",
+	READ_SESSION_ERROR_EXIT:   "read_session_error",
+	WRITE_SESSION_ERROR_EXIT:  "write_session_error",
+	ENCODE_SESSION_ERROR_EXIT: "encode_session_error",
+	DECODE_SESSION_ERROR_EXIT: "decode_session_error",
+	OPERATION_ERROR_EXIT:      "operation_error",
+	WRONG_ARGS_EXIT:           "wrong_args",
+	AUTH_ERROR_EXIT:           "auth_error",
+	B2_LIBRARY_ERROR_EXIT:     "b2_error",
+	NOT_FOUND_EXIT:            "not_found",
+	PERMISSION_DENIED_EXIT:    "permission_denied",
+	CAP_EXCEEDED_EXIT:         "cap_exceeded",
+	NETWORK_ERROR_EXIT:        "network_error",
+	CHECKSUM_MISMATCH_EXIT:    "checksum_mismatch",
+}
+
+func checkOutputFormat(cmd *cobra.Command, args []string) error {
+	for _, format := range outputFormats {
+		if outputFormat == format {
+			return nil
+		}
+	}
+	outputFormat = "table"
+	return withExitCode(fmt.Errorf("--output should be one of %s!", strings.Join(outputFormats, ", ")), WRONG_ARGS_EXIT)
+}
+
+// machineOutput report whether results are printed as JSON.
+func machineOutput() bool {
+	return outputFormat == "json" || outputFormat == "jsonl"
+}
+
+// stdoutIsData is set by commands writing file contents to stdout, such as cat.
+var stdoutIsData bool
+
+// messageOutput return where messages go, stderr if stdout carries JSON results or data.
+func messageOutput() io.Writer {
+	if machineOutput() || stdoutIsData {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+func printJSON(v interface{}, indent bool) error {
+	var (
+		b   []byte
+		err error
+	)
+	if indent {
+		b, err = json.MarshalIndent(v, "", "    ")
+	} else {
+		b, err = json.Marshal(v)
+	}
+	if err != nil {
+		return withExitCode(err, OPERATION_ERROR_EXIT)
+	}
+	fmt.Println(string(b))
+	return nil
+}
+
+// printResult print a result as JSON, or with text for table and plain.
+func printResult(result interface{}, text func()) error {
+	switch outputFormat {
+	case "json":
+		return printJSON(result, true)
+	case "jsonl":
+		return printJSON(result, false)
+	default:
+		if text != nil {
+			text()
+		}
+	}
+	return nil
+}
+
+// printResults print a slice of results as a JSON array, as JSON lines, or with text.
+func printResults(results interface{}, text func()) error {
+	v := reflect.ValueOf(results)
+	switch outputFormat {
+	case "json":
+		if v.Len() == 0 {
+			results = []interface{}{}
+		}
+		return printJSON(results, true)
+	case "jsonl":
+		for i := 0; i < v.Len(); i++ {
+			if err := printJSON(v.Index(i).Interface(), false); err != nil {
+				return err
+			}
+		}
+	default:
+		if text != nil {
+			text()
+		}
+	}
+	return nil
+}
+
+// transferSummary is the result of uploading or downloading a directory.
+type transferSummary struct {
+	Transferred int      `json:"transferred"`
+	Unchanged   int      `json:"unchanged"`
+	Failures    []string `json:"failures"`
+}
+
+// errorOutput is an error printed to stderr with --output json or jsonl.
+type errorOutput struct {
+	Error  string `json:"error"`
+	Code   string `json:"code"`
+	B2Code string `json:"b2Code,omitempty"`
+	Status int    `json:"status"`
+}
+
+// exitWithError print err to stderr, as a JSON object with --output json or jsonl, and exit.
+// The exit code is derived from err if it is returned by b2 or withExitCode, see errorExitCode.
+func exitWithError(err error, exitCode int) {
+	exitCode = errorExitCode(err, exitCode)
+	message := strings.TrimSpace(err.Error())
+	if machineOutput() {
+		output := &errorOutput{Error: message, Code: exitCodeNames[exitCode], B2Code: b2.ErrorCode(err), Status: exitCode}
+		b, _ := json.Marshal(output)
+		fmt.Fprintln(os.Stderr, string(b))
+	} else {
+		fmt.Fprintln(os.Stderr, message)
+	}
+	os.Exit(exitCode)
+}
+
+// jsonProgress report whether progress is printed as JSON lines to stderr instead of
+// bars, which is when results are JSON or stdout is not a terminal.
+func jsonProgress() bool {
+	if machineOutput() {
+		return true
+	}
+	info, err := os.Stdout.Stat()
+	return err != nil || info.Mode()&os.ModeCharDevice == 0
+}
+
+// newProgress return a progress container, its bars are hidden with JSON progress.
+func newProgress(options ...mpb.ProgressOption) *mpb.Progress {
+	if jsonProgress() {
+		options = append(options, mpb.WithOutput(ioutil.Discard))
+	}
+	return mpb.New(options...)
+}
+
+// progressOutput is a JSON progress event.
+type progressOutput struct {
+	Event string `json:"event"`
+	Name  string `json:"name"`
+	Done  int64  `json:"done"`
+	Total int64  `json:"total,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// progressEvents print the progress of a transfer named name as JSON lines to stderr,
+// bytes transferred are printed at most once every PROGRESS_INTERVAL.
+func progressEvents(name string) b2.ProgressListener {
+	var (
+		mu      sync.Mutex
+		done    int64
+		total   int64
+		printed time.Time
+	)
+	return b2.ProgressListenerFunc(func(event *b2.ProgressEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		done += event.Bytes
+		if event.Total > 0 {
+			total = event.Total
+		}
+		switch event.Type {
+		case b2.PartStarted, b2.PartFinished:
+			return
+		case b2.BytesTransferred:
+			if time.Since(printed) < PROGRESS_INTERVAL {
+				return
+			}
+		}
+		printed = time.Now()
+
+		output := &progressOutput{Event: event.Type.String(), Name: name, Done: done, Total: total}
+		if event.Err != nil {
+			output.Error = event.Err.Error()
+		}
+		b, _ := json.Marshal(output)
+		fmt.Fprintln(os.Stderr, string(b))
+	})
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVarP(
+		&outputFormat,
+		"output",
+		"o",
+		"table",
+		"output format: table, plain, json, jsonl, or csv for ls")
+	rootCmd.PersistentPreRunE = checkOutputFormat
+}
@@ -0,0 +1,448 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/hryyan/b2"
+	"github.com/spf13/cobra"
+)
+
+var (
+	stateFile   string
+	stateFormat string
+)
+
+// DesiredState is the buckets and keys declared in a file like b2.yaml.
+// Buckets and keys which are not declared are left as is.
+type DesiredState struct {
+	Buckets []*DesiredBucket `json:"buckets,omitempty"`
+	Keys    []*DesiredKey    `json:"keys,omitempty"`
+}
+
+type DesiredBucket struct {
+	Name           string             `json:"name"`
+	Type           string             `json:"type"`
+	Info           map[string]string  `json:"info,omitempty"`
+	CorsRules      []b2.CorsRule      `json:"corsRules,omitempty"`
+	LifecycleRules []b2.LifecycleRule `json:"lifecycleRules,omitempty"`
+}
+
+// DesiredKey is an application key identified by its name.
+type DesiredKey struct {
+	Name         string          `json:"name"`
+	Capabilities []b2.Capability `json:"capabilities"`
+	Bucket       string          `json:"bucket,omitempty"`
+	Prefix       string          `json:"prefix,omitempty"`
+}
+
+// stateChange is a change to apply, described by lines like "+ bucket site".
+// A change with err is refused, apply makes no change if any change is refused.
+type stateChange struct {
+	lines []string
+	err   error
+	apply func() error
+}
+
+// stateDiff compare the desired state with the account.
+type stateDiff struct {
+	client    *b2.B2
+	bucketIds map[string]string
+	changes   []*stateChange
+}
+
+func readDesiredState(fileName string) (*DesiredState, error) {
+	state := &DesiredState{}
+	if err := readConfigFile(fileName, state); err != nil {
+		return nil, withExitCode(err, WRONG_ARGS_EXIT)
+	}
+
+	seen := map[string]bool{}
+	for _, bucket := range state.Buckets {
+		if bucket.Name == "" || seen["bucket "+bucket.Name] {
+			return nil, withExitCode(fmt.Errorf("Bucket names should be unique and not empty in %s!", fileName), WRONG_ARGS_EXIT)
+		}
+		if bucket.Type != b2.PUBLIC && bucket.Type != b2.PRIVATE {
+			return nil, withExitCode(fmt.Errorf("Type of bucket %s should be %s or %s!", bucket.Name, b2.PUBLIC, b2.PRIVATE), WRONG_ARGS_EXIT)
+		}
+		seen["bucket "+bucket.Name] = true
+	}
+	for _, key := range state.Keys {
+		if key.Name == "" || seen["key "+key.Name] {
+			return nil, withExitCode(fmt.Errorf("Key names should be unique and not empty in %s!", fileName), WRONG_ARGS_EXIT)
+		}
+		seen["key "+key.Name] = true
+	}
+	return state, nil
+}
+
+// canonical return v decoded from JSON without nulls, empty lists and empty maps,
+// so that values differing only in omitted fields are equal.
+func canonical(v interface{}) interface{} {
+	var generic interface{}
+	b, _ := json.Marshal(v)
+	json.Unmarshal(b, &generic)
+	return prune(generic)
+}
+
+func prune(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, item := range v {
+			if item = prune(item); item == nil {
+				delete(v, k)
+			} else {
+				v[k] = item
+			}
+		}
+		if len(v) == 0 {
+			return nil
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = prune(item)
+		}
+		if len(v) == 0 {
+			return nil
+		}
+	}
+	return v
+}
+
+// same compare values by canonical.
+func same(a, b interface{}) bool {
+	return reflect.DeepEqual(canonical(a), canonical(b))
+}
+
+func toJSON(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+func sortedCapabilities(capabilities []b2.Capability) []string {
+	names := make([]string, len(capabilities))
+	for i, c := range capabilities {
+		names[i] = string(c)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (d *stateDiff) diffBucket(desired *DesiredBucket, current *b2.Bucket) {
+	if current == nil {
+		d.changes = append(d.changes, &stateChange{
+			lines: []string{fmt.Sprintf("+ bucket %s (%s)", desired.Name, desired.Type)},
+			apply: func() error {
+				bucket, err := d.client.CreateBucket(desired.Name, desired.Type,
+					desired.Info, desired.CorsRules, desired.LifecycleRules)
+				if err == nil {
+					d.bucketIds[desired.Name] = bucket.BucketId
+				}
+				return err
+			},
+		})
+		return
+	}
+
+	var lines []string
+	if desired.Type != current.BucketType {
+		lines = append(lines, fmt.Sprintf("    type: %s -> %s", current.BucketType, desired.Type))
+	}
+	if !same(desired.Info, current.BucketInfo) {
+		lines = append(lines, fmt.Sprintf("    info: %s -> %s", toJSON(current.BucketInfo), toJSON(desired.Info)))
+	}
+	if !same(desired.CorsRules, current.CorsRules) {
+		lines = append(lines, fmt.Sprintf("    corsRules: %s -> %s", toJSON(current.CorsRules), toJSON(desired.CorsRules)))
+	}
+	if !same(desired.LifecycleRules, current.LifecycleRules) {
+		lines = append(lines, fmt.Sprintf("    lifecycleRules: %s -> %s",
+			toJSON(current.LifecycleRules), toJSON(desired.LifecycleRules)))
+	}
+	if len(lines) == 0 {
+		return
+	}
+
+	d.changes = append(d.changes, &stateChange{
+		lines: append([]string{fmt.Sprintf("~ bucket %s", desired.Name)}, lines...),
+		apply: func() error {
+			bucket := *current
+			bucket.BucketType = desired.Type
+			bucket.BucketInfo = map[string]string{}
+			for k, v := range desired.Info {
+				bucket.BucketInfo[k] = v
+			}
+			bucket.CorsRules = append([]b2.CorsRule{}, desired.CorsRules...)
+			bucket.LifecycleRules = append([]b2.LifecycleRule{}, desired.LifecycleRules...)
+			_, err := d.client.UpdateBucket(&bucket, true)
+			return err
+		},
+	})
+}
+
+// keyMatches report whether an existing key has the scope of desired.
+func (d *stateDiff) keyMatches(desired *DesiredKey, key *b2.ApplicationKey) bool {
+	bucketId := ""
+	if desired.Bucket != "" {
+		var ok bool
+		if bucketId, ok = d.bucketIds[desired.Bucket]; !ok {
+			return false
+		}
+	}
+	return key.BucketId == bucketId &&
+		key.NamePrefix == desired.Prefix &&
+		reflect.DeepEqual(sortedCapabilities(key.Capabilities), sortedCapabilities(desired.Capabilities))
+}
+
+func (d *stateDiff) diffKey(desired *DesiredKey, existing []*b2.ApplicationKey) {
+	for _, key := range existing {
+		if d.keyMatches(desired, key) {
+			return
+		}
+	}
+
+	scope := "*"
+	if desired.Bucket != "" {
+		scope = desired.Bucket + "/" + desired.Prefix + "*"
+	}
+	capabilities := strings.Join(sortedCapabilities(desired.Capabilities), ",")
+	lines := []string{fmt.Sprintf("+ key %s %s %s", desired.Name, scope, capabilities)}
+	if len(existing) > 0 {
+		lines = []string{
+			fmt.Sprintf("-/+ key %s, replacing %d keys, new scope %s %s", desired.Name, len(existing), scope, capabilities),
+			"    the secrets of the replaced keys stop working, update their users with the new secret",
+		}
+	}
+
+	var err error
+	for _, key := range existing {
+		if key.ApplicationKeyId == d.client.KeyId {
+			err = fmt.Errorf("Key %s(%s) is in use, apply with another key", key.KeyName, key.ApplicationKeyId)
+		}
+	}
+
+	d.changes = append(d.changes, &stateChange{
+		lines: lines,
+		err:   err,
+		apply: func() error {
+			spec := &b2.KeySpec{Capabilities: desired.Capabilities, NamePrefix: desired.Prefix}
+			if desired.Bucket != "" {
+				bucketId, ok := d.bucketIds[desired.Bucket]
+				if !ok {
+					return fmt.Errorf("Can not find bucket %s", desired.Bucket)
+				}
+				spec.BucketId = bucketId
+			}
+			key, err := d.client.CreateKeyWithSpec(desired.Name, 0, spec)
+			if err != nil {
+				return err
+			}
+			printNewKey(key)
+
+			for _, old := range existing {
+				if err = d.client.DeleteKey(old); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
+
+// diffState compute the changes from the account to the desired state.
+func diffState(client *b2.B2, state *DesiredState) (*stateDiff, error) {
+	buckets, err := client.ListBuckets("", "", "")
+	if err != nil {
+		return nil, withExitCode(err, B2_LIBRARY_ERROR_EXIT)
+	}
+
+	d := &stateDiff{client: client, bucketIds: map[string]string{}}
+	current := map[string]*b2.Bucket{}
+	for _, bucket := range buckets {
+		current[bucket.BucketName] = bucket
+		d.bucketIds[bucket.BucketName] = bucket.BucketId
+	}
+	for _, desired := range state.Buckets {
+		d.diffBucket(desired, current[desired.Name])
+	}
+
+	if len(state.Keys) > 0 {
+		keys, err := listAllKeys(client)
+		if err != nil {
+			return nil, err
+		}
+
+		existing := map[string][]*b2.ApplicationKey{}
+		for _, key := range keys {
+			existing[key.KeyName] = append(existing[key.KeyName], key)
+		}
+		for _, desired := range state.Keys {
+			d.diffKey(desired, existing[desired.Name])
+		}
+	}
+	return d, nil
+}
+
+// loginDiffState read the desired state in fileName, log in and diff the account with it.
+func loginDiffState(fileName string) (*stateDiff, error) {
+	state, err := readDesiredState(fileName)
+	if err != nil {
+		return nil, err
+	}
+	client, err := login()
+	if err != nil {
+		return nil, err
+	}
+	return diffState(client, state)
+}
+
+func (d *stateDiff) print() {
+	if len(d.changes) == 0 {
+		fmt.Fprintln(messageOutput(), "No changes, the account matches the desired state.")
+		return
+	}
+	for _, change := range d.changes {
+		for _, line := range change.lines {
+			fmt.Fprintln(messageOutput(), line)
+		}
+		if change.err != nil {
+			fmt.Fprintf(messageOutput(), "    ! %s\n", change.err.Error())
+		}
+	}
+	fmt.Fprintf(messageOutput(), "%d changes.\n", len(d.changes))
+}
+
+// refused return the error of the first refused change.
+func (d *stateDiff) refused() error {
+	for _, change := range d.changes {
+		if change.err != nil {
+			return fmt.Errorf("Refuse %q: %s", change.lines[0], change.err.Error())
+		}
+	}
+	return nil
+}
+
+var planCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Show the changes to make the account match a desired state file",
+	Args:  cobra.ExactArgs(0),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		d, err := loginDiffState(stateFile)
+		if err != nil {
+			return err
+		}
+		d.print()
+		return nil
+	},
+}
+
+var applyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Make the account match a desired state file",
+	Args:  cobra.ExactArgs(0),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		d, err := loginDiffState(stateFile)
+		if err != nil {
+			return err
+		}
+		d.print()
+		if err = d.refused(); err != nil {
+			return withExitCode(err, WRONG_ARGS_EXIT)
+		}
+
+		for _, change := range d.changes {
+			if err = change.apply(); err != nil {
+				return withExitCode(fmt.Errorf("Apply %q failed: %s", change.lines[0], err.Error()),
+					errorExitCode(err, B2_LIBRARY_ERROR_EXIT))
+			}
+		}
+		if len(d.changes) > 0 {
+			fmt.Fprintln(messageOutput(), "Apply successed!")
+		}
+		return nil
+	},
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Print the buckets and keys of the account as a desired state file",
+	Args:  cobra.ExactArgs(0),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if stateFormat != "json" && stateFormat != "yaml" {
+			return withExitCode(errors.New("--format should be json or yaml!"), WRONG_ARGS_EXIT)
+		}
+
+		client, err := login()
+		if err != nil {
+			return err
+		}
+		buckets, err := client.ListBuckets("", "", "")
+		if err != nil {
+			return withExitCode(err, B2_LIBRARY_ERROR_EXIT)
+		}
+		keys, err := listAllKeys(client)
+		if err != nil {
+			return err
+		}
+
+		state := &DesiredState{}
+		names := map[string]string{}
+		for _, bucket := range buckets {
+			names[bucket.BucketId] = bucket.BucketName
+			state.Buckets = append(state.Buckets, &DesiredBucket{
+				Name:           bucket.BucketName,
+				Type:           bucket.BucketType,
+				Info:           bucket.BucketInfo,
+				CorsRules:      bucket.CorsRules,
+				LifecycleRules: bucket.LifecycleRules,
+			})
+		}
+		exported := map[string]bool{}
+		for _, key := range keys {
+			if exported[key.KeyName] {
+				// keys are identified by names, only the first is kept
+				continue
+			}
+			exported[key.KeyName] = true
+
+			bucketName, ok := names[key.BucketId]
+			if !ok {
+				bucketName = key.BucketId
+			}
+			state.Keys = append(state.Keys, &DesiredKey{
+				Name:         key.KeyName,
+				Capabilities: key.Capabilities,
+				Bucket:       bucketName,
+				Prefix:       key.NamePrefix,
+			})
+		}
+
+		b, err := marshal(state, stateFormat == "yaml")
+		if err != nil {
+			return withExitCode(err, OPERATION_ERROR_EXIT)
+		}
+		fmt.Println(strings.TrimSpace(string(b)))
+		return nil
+	},
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{planCmd, applyCmd} {
+		cmd.Flags().StringVarP(
+			&stateFile,
+			"file",
+			"f",
+			"b2.yaml",
+			"desired state file in YAML or JSON")
+	}
+	exportCmd.Flags().StringVar(
+		&stateFormat,
+		"format",
+		"yaml",
+		"output format: yaml or json")
+
+	rootCmd.AddCommand(planCmd, applyCmd, exportCmd)
+}
@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hryyan/b2"
+)
+
+func TestCanonical(t *testing.T) {
+	for _, check := range []struct {
+		a, b interface{}
+		same bool
+	}{
+		{nil, map[string]string{}, true},
+		{[]b2.CorsRule{}, nil, true},
+		{map[string]interface{}{"a": []interface{}{}, "b": map[string]interface{}{}}, nil, true},
+		{map[string]string{"a": "1"}, map[string]string{"a": "1"}, true},
+		{map[string]string{"a": "1"}, map[string]string{"a": "2"}, false},
+		{map[string]string{"a": "1"}, nil, false},
+		{[]string{"a", "b"}, []string{"b", "a"}, false},
+		{
+			[]b2.LifecycleRule{{FileNamePrefix: "logs/", DaysFromUploadingToHiding: 7}},
+			[]b2.LifecycleRule{{FileNamePrefix: "logs/", DaysFromUploadingToHiding: 7}},
+			true,
+		},
+		{
+			[]b2.LifecycleRule{{FileNamePrefix: "logs/", DaysFromUploadingToHiding: 7}},
+			[]b2.LifecycleRule{{FileNamePrefix: "logs/", DaysFromUploadingToHiding: 30}},
+			false,
+		},
+	} {
+		if got := same(check.a, check.b); got != check.same {
+			t.Errorf("same(%s, %s) should be %v", toJSON(check.a), toJSON(check.b), check.same)
+		}
+	}
+
+	pruned := prune(map[string]interface{}{
+		"keep":  "1",
+		"empty": map[string]interface{}{"nested": []interface{}{}},
+		"list":  []interface{}{map[string]interface{}{"a": nil}, "2"},
+	})
+	if toJSON(pruned) != `{"keep":"1","list":[null,"2"]}` {
+		t.Fatalf("Wrong pruned value %s", toJSON(pruned))
+	}
+}
+
+func newTestDiff() *stateDiff {
+	return &stateDiff{
+		client:    &b2.B2{KeyId: "key0001"},
+		bucketIds: map[string]string{"logs": "bucket0001"},
+	}
+}
+
+func TestDiffBucket(t *testing.T) {
+	d := newTestDiff()
+	current := &b2.Bucket{
+		BucketId:   "bucket0001",
+		BucketName: "logs",
+		BucketType: b2.PRIVATE,
+		BucketInfo: map[string]string{},
+	}
+
+	d.diffBucket(&DesiredBucket{Name: "logs", Type: b2.PRIVATE}, current)
+	if len(d.changes) != 0 {
+		t.Fatalf("Bucket without changes should not be changed, got %v", d.changes[0].lines)
+	}
+
+	d.diffBucket(&DesiredBucket{Name: "site", Type: b2.PUBLIC}, nil)
+	d.diffBucket(&DesiredBucket{
+		Name: "logs",
+		Type: b2.PUBLIC,
+		Info: map[string]string{"owner": "ops"},
+	}, current)
+	if len(d.changes) != 2 {
+		t.Fatalf("Should make 2 changes, got %d", len(d.changes))
+	}
+	if lines := d.changes[0].lines; len(lines) != 1 || lines[0] != "+ bucket site (allPublic)" {
+		t.Fatalf("Wrong creation %v", lines)
+	}
+
+	lines := d.changes[1].lines
+	if len(lines) != 3 || lines[0] != "~ bucket logs" ||
+		lines[1] != "    type: allPrivate -> allPublic" ||
+		lines[2] != `    info: {} -> {"owner":"ops"}` {
+		t.Fatalf("Wrong update %v", lines)
+	}
+	if d.refused() != nil {
+		t.Fatal("Bucket changes should not be refused")
+	}
+}
+
+func TestDiffKey(t *testing.T) {
+	reader := &DesiredKey{
+		Name:         "reader",
+		Capabilities: []b2.Capability{b2.READ_FILES, b2.LIST_FILES},
+		Bucket:       "logs",
+		Prefix:       "app/",
+	}
+	matching := &b2.ApplicationKey{
+		ApplicationKeyId: "key0002",
+		KeyName:          "reader",
+		Capabilities:     []b2.Capability{b2.LIST_FILES, b2.READ_FILES},
+		BucketId:         "bucket0001",
+		NamePrefix:       "app/",
+	}
+	wider := &b2.ApplicationKey{
+		ApplicationKeyId: "key0003",
+		KeyName:          "reader",
+		Capabilities:     []b2.Capability{b2.LIST_FILES, b2.READ_FILES},
+		BucketId:         "bucket0001",
+	}
+
+	d := newTestDiff()
+	d.diffKey(reader, []*b2.ApplicationKey{wider, matching})
+	if len(d.changes) != 0 {
+		t.Fatalf("A matching key should not be replaced, got %v", d.changes[0].lines)
+	}
+
+	d.diffKey(reader, nil)
+	if lines := d.changes[0].lines; len(lines) != 1 || lines[0] != "+ key reader logs/app/* listFiles,readFiles" {
+		t.Fatalf("Wrong creation %v", lines)
+	}
+
+	d = newTestDiff()
+	d.diffKey(reader, []*b2.ApplicationKey{wider})
+	lines := d.changes[0].lines
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "-/+ key reader, replacing 1 keys") ||
+		!strings.Contains(lines[1], "stop working") {
+		t.Fatalf("Replacement should warn about the old secrets, got %v", lines)
+	}
+	if d.refused() != nil {
+		t.Fatal("Replacement of a key not in use should not be refused")
+	}
+
+	d = newTestDiff()
+	d.client.KeyId = wider.ApplicationKeyId
+	d.diffKey(reader, []*b2.ApplicationKey{wider})
+	if err := d.refused(); err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Fatalf("Replacement of the key in use should be refused, got %v", err)
+	}
+
+	d = newTestDiff()
+	d.diffKey(&DesiredKey{Name: "reader", Capabilities: reader.Capabilities, Bucket: "missing"}, []*b2.ApplicationKey{matching})
+	if len(d.changes) != 1 {
+		t.Fatal("A key of a missing bucket should be replaced")
+	}
+}
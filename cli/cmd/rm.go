@@ -0,0 +1,213 @@
+package cmd
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hryyan/b2"
+	"github.com/spf13/cobra"
+)
+
+// RM_CONFIRM_THRESHOLD is the number of files above which rm asks for confirmation.
+const RM_CONFIRM_THRESHOLD = 100
+
+var (
+	rmAllVersions bool
+	rmOlderThan   string
+	rmHide        bool
+	rmDryRun      bool
+	rmYes         bool
+)
+
+// rmPattern select file names by an exact name, a prefix ending with "/" or a glob.
+type rmPattern struct {
+	pattern string
+	glob    bool
+}
+
+func newRmPattern(pattern string) (*rmPattern, error) {
+	glob := strings.ContainsAny(pattern, "*?[")
+	if glob {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, withExitCode(fmt.Errorf("Bad glob pattern %s!", pattern), WRONG_ARGS_EXIT)
+		}
+	}
+	return &rmPattern{pattern: pattern, glob: glob}, nil
+}
+
+// prefix return the literal prefix of the pattern to narrow the listing.
+func (p *rmPattern) prefix() string {
+	if i := strings.IndexAny(p.pattern, "*?[\\"); i >= 0 {
+		return p.pattern[:i]
+	}
+	return p.pattern
+}
+
+func (p *rmPattern) match(fileName string) bool {
+	switch {
+	case p.glob:
+		ok, _ := path.Match(p.pattern, fileName)
+		return ok
+	case strings.HasSuffix(p.pattern, "/"):
+		return strings.HasPrefix(fileName, p.pattern)
+	default:
+		return fileName == p.pattern
+	}
+}
+
+// rmTargets return the versions matching patterns, keyed by a printable name.
+func rmTargets(client *b2.B2, bucket *b2.Bucket, patterns []*rmPattern, before int64) (map[string]*b2.File, error) {
+	targets := map[string]*b2.File{}
+	for _, pattern := range patterns {
+		var (
+			files []*b2.File
+			err   error
+		)
+		if rmAllVersions {
+			files, err = listVersions(client, bucket.BucketId, pattern.prefix())
+		} else {
+			files, err = listFiles(client, bucket.BucketId, pattern.prefix())
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, file := range files {
+			if !pattern.match(file.FileName) || (before > 0 && file.UploadTimestamp >= before) {
+				continue
+			}
+
+			key := file.FileName
+			if rmAllVersions && !rmHide {
+				key = fmt.Sprintf("%s (%s)", file.FileName, file.FileId)
+			}
+			targets[key] = file
+		}
+	}
+	return targets, nil
+}
+
+var rmCmd = &cobra.Command{
+	Use:   "rm bucket pattern [pattern ..]",
+	Short: "Delete or hide files by names, prefixes or glob patterns",
+	Long: `Delete or hide the files matching the patterns. A pattern is a file name,
+a prefix ending with "/", or a glob pattern like "logs/*.gz" where "*"
+does not match "/". Only the latest versions are deleted unless --all-versions.`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var patterns []*rmPattern
+		for _, arg := range args[1:] {
+			pattern, err := newRmPattern(arg)
+			if err != nil {
+				return err
+			}
+			patterns = append(patterns, pattern)
+		}
+
+		var before int64
+		if rmOlderThan != "" {
+			olderThan, err := parseDuration(rmOlderThan)
+			if err != nil {
+				return withExitCode(err, WRONG_ARGS_EXIT)
+			}
+			before = time.Now().Add(-olderThan).UnixNano() / int64(time.Millisecond)
+		}
+		if concurrency < 1 {
+			concurrency = 1
+		}
+
+		client, bucket, err := loginBucket(args[0])
+		if err != nil {
+			return err
+		}
+		targets, err := rmTargets(client, bucket, patterns, before)
+		if err != nil {
+			return err
+		}
+
+		keys := make([]string, 0, len(targets))
+		for key := range targets {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		action := "delete"
+		if rmHide {
+			action = "hide"
+		}
+
+		if rmDryRun {
+			for _, key := range keys {
+				fmt.Fprintf(messageOutput(), "%s %s\n", action, key)
+			}
+			fmt.Fprintf(messageOutput(), "Dry run, %d files to %s.\n", len(keys), action)
+			return nil
+		}
+
+		if len(keys) == 0 {
+			fmt.Fprintln(messageOutput(), "No files matched.")
+			return nil
+		}
+		if len(keys) > RM_CONFIRM_THRESHOLD && !rmYes &&
+			!confirm(fmt.Sprintf("Going to %s %d files in %s, continue?", action, len(keys), bucket.BucketName)) {
+			return errAborted
+		}
+
+		failures := forEach(concurrency, keys, func(key string) error {
+			file := targets[key]
+			var err error
+			if rmHide {
+				err = client.HideFile(bucket.BucketId, file.FileName)
+			} else {
+				err = client.DeleteFileVersion(file.FileName, file.FileId)
+			}
+			if err == nil {
+				fmt.Fprintf(messageOutput(), "%s %s\n", action, key)
+			}
+			return err
+		})
+
+		fmt.Fprintf(messageOutput(), "Done, %d files, %d failed.\n", len(keys)-len(failures), len(failures))
+		return failuresError(failures)
+	},
+}
+
+func init() {
+	rmCmd.Flags().BoolVar(
+		&rmAllVersions,
+		"all-versions",
+		false,
+		"delete all versions of the matched files, including hide markers")
+	rmCmd.Flags().StringVar(
+		&rmOlderThan,
+		"older-than",
+		"",
+		"only versions uploaded before this duration, such as 30d")
+	rmCmd.Flags().BoolVar(
+		&rmHide,
+		"hide",
+		false,
+		"hide the matched files instead of deleting them")
+	rmCmd.Flags().BoolVar(
+		&rmDryRun,
+		"dry-run",
+		false,
+		"print the matched files only")
+	rmCmd.Flags().BoolVarP(
+		&rmYes,
+		"yes",
+		"y",
+		false,
+		fmt.Sprintf("do not ask for confirmation above %d files", RM_CONFIRM_THRESHOLD))
+	rmCmd.Flags().Int64VarP(
+		&concurrency,
+		"concurrency",
+		"c",
+		1,
+		"threads for deleting")
+
+	rootCmd.AddCommand(rmCmd)
+}
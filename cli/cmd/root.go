@@ -1,36 +1,51 @@
 package cmd
 
 import (
-	"log"
-	"os"
-	"path"
+	"path/filepath"
 
-	homedir "github.com/mitchellh/go-homedir"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
-	_ "github.com/hryyan/b2"
+	"github.com/hryyan/b2"
 )
 
 var (
-	verbose     bool   = false
-	sessionPath string = ""
+	verbose    bool   = false
+	sessionDir string = ""
+	profile    string = ""
 )
 
 var rootCmd = &cobra.Command{
-	Use: "b2",
+	Use:           "b2",
+	SilenceErrors: true,
 }
 
+// Execute run the command and exit with the code of the error it returned.
+// Errors returned by cobra, such as wrong arguments and unknown commands or flags,
+// exit with WRONG_ARGS_EXIT, see runErrors.
 func Execute() {
+	runErrors(rootCmd)
 	if err := rootCmd.Execute(); err != nil {
+		exitWithError(err, WRONG_ARGS_EXIT)
+	}
+}
+
+// runErrors make the errors returned by the commands exit with OPERATION_ERROR_EXIT
+// unless they carry another exit code, and print the usage for wrong arguments only.
+func runErrors(cmd *cobra.Command) {
+	if run := cmd.RunE; run != nil {
+		cmd.RunE = func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			return withExitCode(run(cmd, args), OPERATION_ERROR_EXIT)
+		}
+	}
+	for _, sub := range cmd.Commands() {
+		runErrors(sub)
 	}
 }
 
 func init() {
 	cobra.OnInitialize(initSession)
-	viper.BindEnv("B2_ACCOUNT_ID")
-	viper.BindEnv("B2_APPLICATION_KEY")
-
 	rootCmd.PersistentFlags().BoolVarP(
 		&verbose,
 		"verbose",
@@ -38,27 +53,17 @@ func init() {
 		false,
 		"Produce verbose output")
 
+	rootCmd.PersistentFlags().StringVar(
+		&profile,
+		"profile",
+		"",
+		"Profile in "+b2.DefaultCredentialsPath()+", defaults to $B2_PROFILE")
+	viper.BindPFlag("profile", rootCmd.PersistentFlags().Lookup("profile"))
+	viper.BindEnv("profile", "B2_PROFILE")
+
 }
 
+// initSession locate the sessions under the config dir.
 func initSession() {
-	home, err := homedir.Dir()
-	if err != nil {
-		log.Println(err.Error())
-		os.Exit(1)
-	}
-
-	sessionPath = path.Join(home, ".b2_session")
-
-	if _, err = os.Stat(sessionPath); os.IsNotExist(err) {
-		if _, err := os.Create(sessionPath); err != nil {
-			log.Println(err.Error())
-		} else {
-			log.Printf("Save session in %s\n", sessionPath)
-		}
-	}
-
-	_, err = os.Open(sessionPath)
-	if err != nil {
-		log.Println(err.Error())
-	}
+	sessionDir = filepath.Join(configDir(), "sessions")
 }
@@ -0,0 +1,296 @@
+package cmd
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"time"
+
+	homedir "github.com/mitchellh/go-homedir"
+
+	"github.com/hryyan/b2"
+)
+
+const (
+	// SESSION_TTL is shorter than the 24 hours an auth token lives, so that a cached
+	// token does not expire in the middle of a command.
+	SESSION_TTL = 23 * time.Hour
+	// SESSION_LOCK_TIMEOUT is how long to wait for another b2 refreshing the session.
+	SESSION_LOCK_TIMEOUT = 30 * time.Second
+	// SESSION_LOCK_STALE is the age of a lock left by a crashed b2. Authorizing takes
+	// a few seconds, and it is shorter than SESSION_LOCK_TIMEOUT so that waiting
+	// processes take over a stale lock instead of timing out.
+	SESSION_LOCK_STALE = 10 * time.Second
+	// SESSION_PASSPHRASE_ENV encrypts the session at rest if set.
+	SESSION_PASSPHRASE_ENV = "B2_SESSION_PASSPHRASE"
+
+	PBKDF2_ITERATIONS = 100000
+	SESSION_KEY_SIZE  = 32
+)
+
+type Login struct {
+	b2.AuthResponse
+	KeyId string `json:"keyId"`
+	// KeyHash changes with the application key, the session is dropped if it does not match.
+	KeyHash   string `json:"keyHash"`
+	ExpiredAt int64  `json:"expiredAt"`
+}
+
+type Session struct {
+	Login `json:"login"`
+}
+
+// sealedSession is a session encrypted with AES-GCM by a key derived from the passphrase.
+type sealedSession struct {
+	Salt  []byte `json:"salt"`
+	Nonce []byte `json:"nonce"`
+	Data  []byte `json:"data"`
+}
+
+// sessionPath return the session file of keyId.
+func sessionPath(keyId string) string {
+	return filepath.Join(sessionDir, url.PathEscape(keyId)+".json")
+}
+
+// keyHash identify the credentials without keeping the application key.
+func keyHash(client *b2.B2) string {
+	h := sha256.Sum256([]byte(client.KeyId + "\x00" + client.ApplicationKey))
+	return hex.EncodeToString(h[:])
+}
+
+// valid report whether the session can be used by client.
+func (session *Session) valid(client *b2.B2) bool {
+	return session != nil &&
+		session.KeyId == client.KeyId &&
+		session.KeyHash == keyHash(client) &&
+		time.Now().Before(time.Unix(session.ExpiredAt, 0))
+}
+
+// pbkdf2Key derive a key of keyLen bytes with PBKDF2-HMAC-SHA256, see RFC 8018.
+func pbkdf2Key(passphrase, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, passphrase)
+	key := make([]byte, 0, keyLen+prf.Size())
+	for block := uint32(1); len(key) < keyLen; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write([]byte{byte(block >> 24), byte(block >> 16), byte(block >> 8), byte(block)})
+		u := prf.Sum(nil)
+		t := append([]byte{}, u...)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
+
+func sessionCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(pbkdf2Key([]byte(passphrase), salt, PBKDF2_ITERATIONS, SESSION_KEY_SIZE))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func seal(b []byte, passphrase string) ([]byte, error) {
+	sealed := &sealedSession{Salt: make([]byte, 16)}
+	if _, err := io.ReadFull(rand.Reader, sealed.Salt); err != nil {
+		return nil, err
+	}
+	aead, err := sessionCipher(passphrase, sealed.Salt)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed.Nonce = make([]byte, aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, sealed.Nonce); err != nil {
+		return nil, err
+	}
+	sealed.Data = aead.Seal(nil, sealed.Nonce, b, nil)
+	return json.Marshal(sealed)
+}
+
+func unseal(sealed *sealedSession, passphrase string) ([]byte, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("The session is encrypted, set %s to use it!", SESSION_PASSPHRASE_ENV)
+	}
+	aead, err := sessionCipher(passphrase, sealed.Salt)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed.Nonce) != aead.NonceSize() {
+		return nil, errors.New("Broken session nonce!")
+	}
+	return aead.Open(nil, sealed.Nonce, sealed.Data, nil)
+}
+
+// readSession return the session of keyId, nil if there is none or it can not be decoded.
+func readSession(keyId string) (*Session, error) {
+	b, err := ioutil.ReadFile(sessionPath(keyId))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, withExitCode(errors.New("Read session file error!"), READ_SESSION_ERROR_EXIT)
+	}
+
+	var sealed sealedSession
+	if err = json.Unmarshal(b, &sealed); err == nil && len(sealed.Data) > 0 {
+		if b, err = unseal(&sealed, os.Getenv(SESSION_PASSPHRASE_ENV)); err != nil {
+			return nil, nil
+		}
+	}
+
+	var session Session
+	if err = json.Unmarshal(b, &session); err != nil {
+		return nil, nil
+	}
+	return &session, nil
+}
+
+// writeSession replace the session of its key atomically, it is readable by the owner only.
+func writeSession(session *Session) error {
+	if err := os.MkdirAll(sessionDir, 0700); err != nil {
+		return withExitCode(errors.New("Create session directory error!"), CREATE_SESSION_ERROR_EXIT)
+	}
+
+	b, err := json.MarshalIndent(session, "", "    ")
+	if err != nil {
+		return withExitCode(errors.New("Encode session file error!"), ENCODE_SESSION_ERROR_EXIT)
+	}
+	if passphrase := os.Getenv(SESSION_PASSPHRASE_ENV); passphrase != "" {
+		if b, err = seal(b, passphrase); err != nil {
+			return withExitCode(errors.New("Encrypt session file error!"), ENCODE_SESSION_ERROR_EXIT)
+		}
+	}
+
+	f, err := ioutil.TempFile(sessionDir, ".session")
+	if err != nil {
+		return withExitCode(errors.New("Create session file error!"), CREATE_SESSION_ERROR_EXIT)
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(b)
+	if err == nil {
+		err = f.Chmod(0600)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), sessionPath(session.KeyId))
+	}
+	if err != nil {
+		return withExitCode(errors.New("Write session file error!"), WRITE_SESSION_ERROR_EXIT)
+	}
+	return nil
+}
+
+// removeOldSession remove the world-readable ~/.b2_session of older versions, once
+// as it is not written again.
+func removeOldSession() {
+	home, err := homedir.Dir()
+	if err != nil {
+		return
+	}
+
+	oldPath := filepath.Join(home, ".b2_session")
+	if err = os.Remove(oldPath); err == nil {
+		fmt.Fprintf(os.Stderr, "Removed %s of an older b2, sessions are kept in %s now.\n", oldPath, sessionDir)
+	}
+}
+
+// removeSession drop the session of keyId, such as when its token is rejected.
+func removeSession(keyId string) {
+	os.Remove(sessionPath(keyId))
+}
+
+// lockSession lock the session of keyId against other b2 processes, see lockFile.
+func lockSession(keyId string, timeout time.Duration) (func(), error) {
+	if err := os.MkdirAll(sessionDir, 0700); err != nil {
+		return nil, err
+	}
+	return lockFile(sessionPath(keyId)+".lock", timeout)
+}
+
+// lockFile take lockPath against other b2 processes within timeout and return the
+// unlock function, which can be called more than once. The lock is released if b2
+// is interrupted before unlocking, so that other processes do not wait for it.
+// The lock is a file created exclusively, which works on every platform b2 is built for.
+func lockFile(lockPath string, timeout time.Duration) (func(), error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			f.Close()
+			return releaseOnInterrupt(lockPath), nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+
+		if info, err := os.Stat(lockPath); err == nil && time.Since(info.ModTime()) > SESSION_LOCK_STALE {
+			os.Remove(lockPath)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("Locked by another b2, remove %s if none is running!", lockPath)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// releaseOnInterrupt return the function removing lockPath, which is also called
+// if b2 is interrupted by Ctrl-C until then.
+func releaseOnInterrupt(lockPath string) func() {
+	var (
+		once        sync.Once
+		done        = make(chan struct{})
+		interrupted = make(chan os.Signal, 1)
+	)
+	unlock := func() {
+		once.Do(func() {
+			signal.Stop(interrupted)
+			close(done)
+			os.Remove(lockPath)
+		})
+	}
+
+	signal.Notify(interrupted, os.Interrupt)
+	go func() {
+		select {
+		case <-interrupted:
+			unlock()
+			os.Exit(INTERRUPTED_EXIT)
+		case <-done:
+		}
+	}()
+	return unlock
+}
+
+// sessionObserver drop the session of keyId once b2 rejects its auth token,
+// so that the next command authorizes again.
+func sessionObserver(keyId string) b2.Observer {
+	return b2.ObserverFunc(func(op *b2.Operation) {
+		if op.StatusCode == 401 && (op.ErrorCode == "bad_auth_token" || op.ErrorCode == "expired_auth_token") {
+			removeSession(keyId)
+		}
+	})
+}
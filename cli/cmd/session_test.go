@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hryyan/b2"
+)
+
+func TestPbkdf2Key(t *testing.T) {
+	// test vectors of PBKDF2-HMAC-SHA256 from RFC 7914
+	for _, check := range []struct {
+		passphrase, salt string
+		iterations       int
+		want             string
+	}{
+		{"passwd", "salt", 1,
+			"55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc" +
+				"49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"},
+		{"Password", "NaCl", 80000,
+			"4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56" +
+				"a1d425a1225833549adb841b51c9b3176a272bdebba1d078478f62b397f33c8d"},
+	} {
+		want, _ := hex.DecodeString(check.want)
+		for _, keyLen := range []int{64, 32, 20} {
+			got := pbkdf2Key([]byte(check.passphrase), []byte(check.salt), check.iterations, keyLen)
+			if !bytes.Equal(got, want[:keyLen]) {
+				t.Errorf("pbkdf2Key(%q, %q, %d, %d) = %x, want %x",
+					check.passphrase, check.salt, check.iterations, keyLen, got, want[:keyLen])
+			}
+		}
+	}
+}
+
+func TestSealSession(t *testing.T) {
+	plain := []byte(`{"login":{"keyId":"key0001"}}`)
+	b, err := seal(plain, "secret")
+	if err != nil {
+		t.Fatalf("Seal failed: %s", err.Error())
+	}
+	if bytes.Contains(b, []byte("key0001")) {
+		t.Fatalf("Sealed session should not contain the plain text, got %s", b)
+	}
+
+	var sealed sealedSession
+	if err = json.Unmarshal(b, &sealed); err != nil {
+		t.Fatal(err)
+	}
+	if opened, err := unseal(&sealed, "secret"); err != nil || !bytes.Equal(opened, plain) {
+		t.Fatalf("Unseal = %q, %v, want %q", opened, err, plain)
+	}
+
+	for _, passphrase := range []string{"", "wrong"} {
+		if _, err = unseal(&sealed, passphrase); err == nil {
+			t.Errorf("Unseal with passphrase %q should fail", passphrase)
+		}
+	}
+}
+
+func TestSessionValid(t *testing.T) {
+	client := &b2.B2{KeyId: "key0001", ApplicationKey: "secret"}
+	session := &Session{Login{
+		KeyId:     client.KeyId,
+		KeyHash:   keyHash(client),
+		ExpiredAt: time.Now().Add(time.Hour).Unix(),
+	}}
+	if !session.valid(client) {
+		t.Fatal("Session of the key should be valid")
+	}
+
+	for name, change := range map[string]func(s *Session){
+		"another key id":          func(s *Session) { s.KeyId = "key0002" },
+		"another application key": func(s *Session) { s.KeyHash = keyHash(&b2.B2{KeyId: "key0001", ApplicationKey: "rotated"}) },
+		"an expired token":        func(s *Session) { s.ExpiredAt = time.Now().Add(-time.Second).Unix() },
+	} {
+		changed := *session
+		change(&changed)
+		if changed.valid(client) {
+			t.Errorf("Session with %s should be invalid", name)
+		}
+	}
+
+	var missing *Session
+	if missing.valid(client) {
+		t.Error("Missing session should be invalid")
+	}
+}
+
+func TestLockSession(t *testing.T) {
+	dir := sessionDir
+	t.Cleanup(func() { sessionDir = dir })
+	sessionDir = t.TempDir()
+	lockPath := sessionPath("key0001") + ".lock"
+
+	unlock, err := lockSession("key0001", time.Second)
+	if err != nil {
+		t.Fatalf("Lock failed: %s", err.Error())
+	}
+	if _, err = lockSession("key0001", 300*time.Millisecond); err == nil {
+		t.Fatal("Locked session should time out")
+	}
+	if _, err = os.Stat(lockPath); err != nil {
+		t.Fatalf("Lock should be kept after timing out, got %v", err)
+	}
+
+	unlock()
+	unlock()
+	if _, err = os.Stat(lockPath); !os.IsNotExist(err) {
+		t.Fatalf("Lock should be removed, got %v", err)
+	}
+
+	// a lock left by a crashed b2 is taken over before timing out
+	unlock, err = lockSession("key0001", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale := time.Now().Add(-SESSION_LOCK_STALE - time.Second)
+	if err = os.Chtimes(lockPath, stale, stale); err != nil {
+		t.Fatal(err)
+	}
+	relock, err := lockSession("key0001", time.Second)
+	if err != nil {
+		t.Fatalf("Stale lock should be taken over, got %s", err.Error())
+	}
+	relock()
+	unlock()
+}
@@ -1,69 +1,283 @@
 package cmd
 
 import (
-	"bufio"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/hryyan/b2"
 	"github.com/spf13/cobra"
 )
 
+var (
+	shareTTL        string
+	shareDownloadAs string
+	sharePrefix     bool
+	sharePublic     bool
+	shareListAll    bool
+)
+
+// SharedLink is a download url issued by "share".
+type SharedLink struct {
+	AccountId  string `json:"accountId"`
+	BucketName string `json:"bucketName"`
+	FileName   string `json:"fileName"`
+	Prefix     bool   `json:"prefix,omitempty"`
+	URL        string `json:"url"`
+	CreatedAt  int64  `json:"createdAt"`
+	ExpiresAt  int64  `json:"expiresAt,omitempty"`
+}
+
+func sharedLinksPath() string {
+	return filepath.Join(configDir(), "shared_links.json")
+}
+
+func readSharedLinks() ([]*SharedLink, error) {
+	var links []*SharedLink
+	b, err := ioutil.ReadFile(sharedLinksPath())
+	if os.IsNotExist(err) {
+		return links, nil
+	} else if err != nil {
+		return nil, withExitCode(err, OPERATION_ERROR_EXIT)
+	}
+
+	if err = json.Unmarshal(b, &links); err != nil {
+		return nil, withExitCode(fmt.Errorf("Decode %s error!", sharedLinksPath()), OPERATION_ERROR_EXIT)
+	}
+	return links, nil
+}
+
+func writeSharedLinks(links []*SharedLink) error {
+	b, err := json.MarshalIndent(links, "", "    ")
+	if err != nil {
+		return withExitCode(err, OPERATION_ERROR_EXIT)
+	}
+
+	if err = os.MkdirAll(configDir(), 0700); err != nil {
+		return withExitCode(err, OPERATION_ERROR_EXIT)
+	}
+	if err = ioutil.WriteFile(sharedLinksPath(), b, 0600); err != nil {
+		return withExitCode(err, OPERATION_ERROR_EXIT)
+	}
+	return nil
+}
+
+// shareTTLSeconds parse --ttl, download authorizations live at most a week.
+func shareTTLSeconds(s string) (int64, error) {
+	ttl, err := parseDuration(s)
+	if err != nil {
+		return 0, withExitCode(err, WRONG_ARGS_EXIT)
+	}
+	if ttl < time.Second || ttl > MAX_VALID_DURATION_IN_SECONDS*time.Second {
+		return 0, withExitCode(errors.New("TTL should be between 1s and 7d!"), WRONG_ARGS_EXIT)
+	}
+	return int64(ttl / time.Second), nil
+}
+
+// contentDisposition return the Content-Disposition downloading as fileName.
+func contentDisposition(fileName string) string {
+	if fileName == "" {
+		return ""
+	}
+	return fmt.Sprintf(`attachment; filename="%s"`, strings.Replace(fileName, `"`, `\"`, -1))
+}
+
+// checkSharedFile return an error if fileName does not exist, and warn if the token of its
+// url also downloads other files, as tokens are scoped to a name prefix.
+func checkSharedFile(client *b2.B2, bucket *b2.Bucket, fileName string) error {
+	page, err := client.ListFileNamesPage(bucket.BucketId, fileName, fileName, "", 2)
+	if err != nil {
+		return withExitCode(err, B2_LIBRARY_ERROR_EXIT)
+	}
+
+	if len(page.Files) == 0 || page.Files[0].FileName != fileName {
+		return withExitCode(fmt.Errorf("Can not find file %s in %s!", fileName, bucket.BucketName), NOT_FOUND_EXIT)
+	}
+	if len(page.Files) > 1 {
+		fmt.Fprintf(messageOutput(), "Warning: the url also downloads other files starting with %s, such as %s, share with --prefix to list them.\n",
+			fileName, page.Files[1].FileName)
+	}
+	return nil
+}
+
 var shareCmd = &cobra.Command{
 	Use:   "share bucket file",
 	Short: "Share file and generate download url",
-	Args:  cobra.ExactArgs(2),
-	Run: func(cmd *cobra.Command, args []string) {
+	Long: `Generate a time-limited download url of a private file. The token of the url
+is scoped to a name prefix by b2, so it also downloads every file whose name
+starts with the file name, such as file.bak for file; share warns about them.
+With --prefix, the file is a prefix and a url is generated for every file under
+it, all signed by one token. Issued urls are recorded and can be listed by
+"share list".`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
 		var (
-			client     = login()
 			bucketName = args[0]
 			fileName   = args[1]
 		)
+		if sharePublic && (sharePrefix || shareDownloadAs != "") {
+			return withExitCode(errors.New("--public can not be used with --prefix or --download-as!"), WRONG_ARGS_EXIT)
+		}
 
-		buckets, err := client.ListBuckets("", bucketName, "")
+		ttl, err := shareTTLSeconds(shareTTL)
+		if err != nil {
+			return err
+		}
+		client, bucket, err := loginBucket(bucketName)
 		if err != nil {
-			fmt.Println(err.Error())
-			os.Exit(B2_LIBRARY_ERROR_EXIT)
+			return err
 		}
 
-		if len(buckets) != 1 {
-			fmt.Printf("Can not find bucket %s!\n", bucketName)
-			os.Exit(OPERATION_ERROR_EXIT)
+		if sharePublic {
+			if bucket.BucketType != b2.PUBLIC {
+				return withExitCode(fmt.Errorf("Bucket %s is not public, share a private url without --public!", bucket.BucketName), OPERATION_ERROR_EXIT)
+			}
+			link := &SharedLink{
+				AccountId:  client.GetAuth().AccountId,
+				BucketName: bucket.BucketName,
+				FileName:   fileName,
+				URL:        client.GetPublicFileDownloadURL(bucket.BucketName, fileName),
+				CreatedAt:  time.Now().Unix(),
+			}
+			return printResult(link, func() {
+				fmt.Println(link.URL)
+			})
 		}
 
-		bucket := buckets[0]
-		if bucket.BucketType != b2.PUBLIC {
-			reader := bufio.NewReader(os.Stdin)
-			for {
-				fmt.Printf(`Bucket %s is not public, `+
-					`do you want to publicise it? Type y / n`+
-					"\n",
-					bucket.BucketName)
-				text, _ := reader.ReadString('\n')
-				text = strings.Trim(text, "\n")
-				if text == "y" {
-					break
-				} else if text == "n" {
-					return
-				} else {
-					fmt.Println("Please type y / n")
-					continue
-				}
+		names := []string{fileName}
+		if !sharePrefix {
+			if err = checkSharedFile(client, bucket, fileName); err != nil {
+				return err
+			}
+		} else {
+			files, err := listFiles(client, bucket.BucketId, fileName)
+			if err != nil {
+				return err
+			}
+			names = names[:0]
+			for _, file := range files {
+				names = append(names, file.FileName)
+			}
+			if len(names) == 0 {
+				return withExitCode(fmt.Errorf("No files under %s in %s!", fileName, bucket.BucketName), NOT_FOUND_EXIT)
 			}
+		}
+
+		disposition := contentDisposition(shareDownloadAs)
+		token, err := client.GetDownloadAuthorizationAs(bucket.BucketId, fileName, ttl, disposition)
+		if err != nil {
+			return withExitCode(err, B2_LIBRARY_ERROR_EXIT)
+		}
+
+		var (
+			now    = time.Now()
+			issued []*SharedLink
+		)
+		for _, name := range names {
+			issued = append(issued, &SharedLink{
+				AccountId:  client.GetAuth().AccountId,
+				BucketName: bucket.BucketName,
+				FileName:   name,
+				Prefix:     sharePrefix,
+				URL:        client.GetAuthorizedFileDownloadURL(bucket.BucketName, name, token.AuthorizationToken, disposition),
+				CreatedAt:  now.Unix(),
+				ExpiresAt:  now.Unix() + ttl,
+			})
+		}
+		links, err := readSharedLinks()
+		if err != nil {
+			return err
+		}
+		if err = writeSharedLinks(append(links, issued...)); err != nil {
+			return err
+		}
+
+		return printResults(issued, func() {
+			for _, link := range issued {
+				fmt.Println(link.URL)
+			}
+		})
+	},
+}
+
+var listShareCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the issued download urls and their expiry",
+	Args:  cobra.ExactArgs(0),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		issued, err := readSharedLinks()
+		if err != nil {
+			return err
+		}
 
-			bucket.BucketType = b2.PUBLIC
-			if _, err = client.UpdateBucket(bucket, false); err != nil {
-				fmt.Println(err.Error())
-				os.Exit(B2_LIBRARY_ERROR_EXIT)
+		var (
+			now    = time.Now().Unix()
+			links  []*SharedLink
+			states []string
+		)
+		for _, link := range issued {
+			state := "valid"
+			if link.ExpiresAt != 0 && now >= link.ExpiresAt {
+				if !shareListAll {
+					continue
+				}
+				state = "expired"
 			}
+			links = append(links, link)
+			states = append(states, state)
 		}
 
-		URL := client.GetPublicFileDownloadURL(bucket.BucketName, fileName)
-		fmt.Println(URL)
+		return printResults(links, func() {
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			for i, link := range links {
+				if outputFormat == "plain" {
+					fmt.Fprintln(w, link.URL)
+					continue
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n",
+					link.BucketName+"/"+link.FileName,
+					time.Unix(link.ExpiresAt, 0).Format(time.RFC3339), states[i], link.URL)
+			}
+			w.Flush()
+		})
 	},
 }
 
 func init() {
+	shareCmd.Flags().StringVar(
+		&shareTTL,
+		"ttl",
+		"1d",
+		"valid duration of the url, at most 7d")
+	shareCmd.Flags().StringVar(
+		&shareDownloadAs,
+		"download-as",
+		"",
+		"file name browsers save the download as")
+	shareCmd.Flags().BoolVar(
+		&sharePrefix,
+		"prefix",
+		false,
+		"share all files under the prefix")
+	shareCmd.Flags().BoolVar(
+		&sharePublic,
+		"public",
+		false,
+		"print the public url, the bucket must be public already")
+
+	listShareCmd.Flags().BoolVar(
+		&shareListAll,
+		"all",
+		false,
+		"include expired urls")
+
+	shareCmd.AddCommand(listShareCmd)
+
 	rootCmd.AddCommand(shareCmd)
 }
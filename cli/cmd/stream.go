@@ -0,0 +1,242 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/hryyan/b2"
+	"github.com/spf13/cobra"
+)
+
+// STDIO is the file argument standing for stdin or stdout.
+const STDIO = "-"
+
+// streamPart is a part read from a stream, buf is returned to the pool after uploading.
+type streamPart struct {
+	number int64
+	buf    []byte
+	data   []byte
+}
+
+// partPool hand out at most size buffers of partSize, allocated on demand.
+type partPool struct {
+	free     chan []byte
+	partSize int64
+}
+
+func newPartPool(size, partSize int64) *partPool {
+	pool := &partPool{free: make(chan []byte, size), partSize: partSize}
+	for i := int64(0); i < size; i++ {
+		pool.free <- nil
+	}
+	return pool
+}
+
+func (pool *partPool) get() []byte {
+	buf := <-pool.free
+	if buf == nil {
+		buf = make([]byte, pool.partSize)
+	}
+	return buf
+}
+
+func (pool *partPool) put(buf []byte) {
+	pool.free <- buf
+}
+
+// read fill a buffer from r, data is shorter than the buffer only at the end of r.
+func (pool *partPool) read(r io.Reader) ([]byte, []byte, error) {
+	buf := pool.get()
+	n, err := io.ReadFull(r, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	return buf, buf[:n], err
+}
+
+// uploadBytes upload data in one request, retrying with a new upload url if it failed.
+func uploadBytes(client *b2.B2, bucket *b2.Bucket, fileName string, data []byte,
+	listener b2.ProgressListener) (*b2.File, error) {
+	var lastErr error
+	for i := 0; i < PART_RETRIES; i++ {
+		uploadUrlToken, err := client.GetUploadUrl(bucket.BucketId)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		file, err := client.UploadBytes(uploadUrlToken, data, fileName, listener)
+		if err == nil {
+			return file, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// uploadStream upload r as fileName without knowing its size. r is read in parts
+// of the recommended part size, at most workers parts are uploaded at a time and
+// workers + 1 parts are held in memory. Streams shorter than two parts are uploaded
+// as a small file.
+func uploadStream(client *b2.B2, bucket *b2.Bucket, fileName string, r io.Reader, workers int64) error {
+	auth := client.GetAuth()
+	partSize := auth.RecommendedPartSize
+	if partSize < auth.AbsoluteMinimumPartSize {
+		partSize = auth.AbsoluteMinimumPartSize
+	}
+
+	var (
+		pool = newPartPool(workers+1, partSize)
+		p    = newProgress()
+		bar  = newBar(p, fileName, 0)
+		read int64
+	)
+
+	abort := func(err error) error {
+		p.Abort(bar, false)
+		p.Wait()
+		return withExitCode(err, B2_LIBRARY_ERROR_EXIT)
+	}
+
+	firstBuf, first, err := pool.read(r)
+	if err != nil {
+		return abort(err)
+	}
+	var second []byte
+	if int64(len(first)) == partSize {
+		if _, second, err = pool.read(r); err != nil {
+			return abort(err)
+		}
+	}
+
+	read = int64(len(first) + len(second))
+	if len(second) == 0 {
+		bar.SetTotal(read, true)
+		file, err := uploadBytes(client, bucket, fileName, first, bytesListener(bar, fileName))
+		if err != nil {
+			return abort(err)
+		}
+		p.Wait()
+		return printResult(file, nil)
+	}
+
+	file, err := client.StartLargeFile(bucket.BucketId, fileName, map[string]string{})
+	if err != nil {
+		return abort(err)
+	}
+	bar.SetTotal(read, false)
+	transfer := b2.NewTransfer(fileName, 0, bytesListener(bar, fileName))
+	transfer.Start()
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		sha1s   = map[int64]string{}
+		lastErr error
+		tasks   = make(chan *streamPart)
+	)
+	failed := func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		return lastErr
+	}
+
+	for i := int64(0); i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for part := range tasks {
+				if failed() == nil {
+					contentSha1, err := retryPart(client, transfer, file.FileId, part.number,
+						func(uploadUrlToken *b2.UploadUrlToken) (string, error) {
+							return client.UploadPartBytes(uploadUrlToken, part.data, part.number, transfer)
+						})
+
+					mu.Lock()
+					if err != nil && lastErr == nil {
+						lastErr = err
+					}
+					sha1s[part.number] = contentSha1
+					mu.Unlock()
+				}
+				pool.put(part.buf)
+			}
+		}()
+	}
+
+	tasks <- &streamPart{number: 1, buf: firstBuf, data: first}
+	var (
+		buf    = second[:cap(second)]
+		data   = second
+		number = int64(2)
+	)
+	for len(data) > 0 && failed() == nil {
+		if number > MAX_PART_COUNT {
+			mu.Lock()
+			lastErr = fmt.Errorf("The stream is larger than %d parts of %s!", MAX_PART_COUNT, humanSize(partSize))
+			mu.Unlock()
+			pool.put(buf)
+			break
+		}
+		tasks <- &streamPart{number: number, buf: buf, data: data}
+		number++
+
+		if buf, data, err = pool.read(r); err != nil {
+			mu.Lock()
+			lastErr = err
+			mu.Unlock()
+			pool.put(buf)
+			break
+		}
+		read += int64(len(data))
+		bar.SetTotal(read, false)
+	}
+	close(tasks)
+	wg.Wait()
+
+	if err = failed(); err != nil {
+		transfer.Finish(err)
+		client.CancelLargeFile(file.FileId)
+		return abort(err)
+	}
+
+	sha1Array := make([]string, len(sha1s))
+	for i := range sha1Array {
+		sha1Array[i] = sha1s[int64(i+1)]
+	}
+	file, err = client.FinishLargeFile(file.FileId, sha1Array)
+	transfer.Finish(err)
+	if err != nil {
+		return abort(err)
+	}
+	bar.SetTotal(read, true)
+	p.Wait()
+	return printResult(file, nil)
+}
+
+var catCmd = &cobra.Command{
+	Use:   "cat bucket file",
+	Short: "Write a file to stdout",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		stdoutIsData = true
+		client, bucket, err := loginBucket(args[0])
+		if err != nil {
+			return err
+		}
+
+		if err = client.DownloadFileByNameTo(bucket.BucketName, args[1], os.Stdout, true, nil); err != nil {
+			return withExitCode(err, B2_LIBRARY_ERROR_EXIT)
+		}
+		return nil
+	},
+}
+
+func init() {
+	addLimitRateFlags(catCmd)
+
+	rootCmd.AddCommand(catCmd)
+}
@@ -0,0 +1,373 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hryyan/b2"
+	"github.com/spf13/cobra"
+)
+
+const (
+	B2_SCHEME   = "b2://"
+	IGNORE_FILE = ".b2ignore"
+)
+
+var (
+	syncCompare  string
+	syncDelete   bool
+	syncHide     bool
+	syncDryRun   bool
+	syncExcludes []string
+)
+
+// location is a local directory, or a bucket and a prefix like b2://bucket/prefix/.
+type location struct {
+	dir        string
+	bucketName string
+	prefix     string
+	bucket     *b2.Bucket
+}
+
+func parseLocation(s string) *location {
+	if !strings.HasPrefix(s, B2_SCHEME) {
+		return &location{dir: filepath.Clean(s)}
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(s, B2_SCHEME), "/", 2)
+	l := &location{bucketName: parts[0]}
+	if len(parts) == 2 && parts[1] != "" {
+		l.prefix = strings.TrimSuffix(parts[1], "/") + "/"
+	}
+	return l
+}
+
+func (l *location) remote() bool {
+	return l.bucketName != ""
+}
+
+func (l *location) String() string {
+	if l.remote() {
+		return B2_SCHEME + l.bucketName + "/" + l.prefix
+	}
+	return l.dir
+}
+
+// syncEntry is a file of a location, its name is relative to the location.
+type syncEntry struct {
+	name     string
+	size     int64
+	modTime  int64
+	sha1     string
+	filePath string
+	file     *b2.File
+}
+
+// hash return the SHA1 of the entry, computing it for local files.
+func (e *syncEntry) hash() string {
+	if e.sha1 == "" && e.file == nil {
+		e.sha1, _ = fileSha1(e.filePath)
+	}
+	return e.sha1
+}
+
+// readIgnoreFile return the glob patterns in the .b2ignore of dir, one pattern per line.
+func readIgnoreFile(dir string) []string {
+	f, err := os.Open(filepath.Join(dir, IGNORE_FILE))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var patterns []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			patterns = append(patterns, line)
+		}
+	}
+	return patterns
+}
+
+// listLocation return the files of l which match filter, by relative name.
+func listLocation(client *b2.B2, l *location, filter *fileFilter) (map[string]*syncEntry, []string, error) {
+	entries := map[string]*syncEntry{}
+
+	if !l.remote() {
+		jobs, failures := walkDir(l.dir, "", filter)
+		for _, job := range jobs {
+			entries[job.fileName] = &syncEntry{
+				name:     job.fileName,
+				size:     job.size,
+				modTime:  job.modTime / 1000,
+				filePath: job.filePath,
+			}
+		}
+		return entries, failures, nil
+	}
+
+	files, err := listFiles(client, l.bucket.BucketId, l.prefix)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, file := range files {
+		name := strings.TrimPrefix(file.FileName, l.prefix)
+		if name == "" || !filter.Match(name) {
+			continue
+		}
+
+		entries[name] = &syncEntry{
+			name:    name,
+			size:    file.ContentLength,
+			modTime: fileModTime(file).Unix(),
+			sha1:    file.Sha1(),
+			file:    file,
+		}
+	}
+	return entries, nil, nil
+}
+
+// differs report whether dst should be replaced by src,
+// modification times are compared if a SHA1 is unknown.
+func differs(src, dst *syncEntry) bool {
+	if src.size != dst.size {
+		return true
+	}
+	if syncCompare == "sha1" && src.hash() != "" && dst.hash() != "" {
+		return src.hash() != dst.hash()
+	}
+	return src.modTime != dst.modTime
+}
+
+func sortedNames(entries map[string]*syncEntry) []string {
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// syncCopy copy the changed files from src to dst and return the number of copied files and failures.
+func syncCopy(client *b2.B2, src, dst *location, srcEntries map[string]*syncEntry, names []string) (int, []string) {
+	switch {
+	case !src.remote():
+		var jobs []*uploadJob
+		for _, name := range names {
+			entry := srcEntries[name]
+			jobs = append(jobs, &uploadJob{
+				filePath: entry.filePath,
+				fileName: dst.prefix + name,
+				size:     entry.size,
+				modTime:  entry.modTime * 1000,
+			})
+		}
+		return uploadAll(client, dst.bucket, jobs, concurrency)
+	case !dst.remote():
+		var (
+			jobs     []*downloadJob
+			failures []string
+		)
+		for _, name := range names {
+			filePath, ok := localPath(dst.dir, "", name)
+			if !ok {
+				failures = append(failures, fmt.Sprintf("%s: unsafe file name", name))
+				continue
+			}
+			jobs = append(jobs, &downloadJob{file: srcEntries[name].file, filePath: filePath})
+		}
+		downloaded, failed := downloadAll(client, jobs, concurrency)
+		return downloaded, append(failures, failed...)
+	default:
+		failures := forEach(concurrency, names, func(name string) error {
+			_, err := client.CopyFile(srcEntries[name].file.FileId, dst.bucket.BucketId, dst.prefix+name)
+			return err
+		})
+		return len(names) - len(failures), failures
+	}
+}
+
+// syncRemove delete or hide the extraneous files of dst.
+func syncRemove(client *b2.B2, dst *location, dstEntries map[string]*syncEntry, names []string) ([]string, error) {
+	if !dst.remote() {
+		return forEach(concurrency, names, func(name string) error {
+			return os.Remove(dstEntries[name].filePath)
+		}), nil
+	}
+
+	if syncHide {
+		return forEach(concurrency, names, func(name string) error {
+			return client.HideFile(dst.bucket.BucketId, dst.prefix+name)
+		}), nil
+	}
+
+	all, err := listVersions(client, dst.bucket.BucketId, dst.prefix)
+	if err != nil {
+		return nil, err
+	}
+	versions := map[string][]*b2.File{}
+	for _, version := range all {
+		versions[version.FileName] = append(versions[version.FileName], version)
+	}
+	return forEach(concurrency, names, func(name string) error {
+		for _, version := range versions[dst.prefix+name] {
+			if err := client.DeleteFileVersion(version.FileName, version.FileId); err != nil {
+				return err
+			}
+		}
+		return nil
+	}), nil
+}
+
+var syncCmd = &cobra.Command{
+	Use:   "sync src dst",
+	Short: "Sync a local directory and a bucket, or two buckets",
+	Long: `Sync copies new and changed files from src to dst, a bucket is written
+as b2://bucket/prefix. Files are compared by size and modification time,
+or by SHA1 with --compare sha1. Patterns in the .b2ignore of the local
+directory are excluded, one glob pattern per line.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		src, dst := parseLocation(args[0]), parseLocation(args[1])
+		if !src.remote() && !dst.remote() {
+			return withExitCode(errors.New("One of src and dst should be a bucket, such as b2://bucket/prefix!"), WRONG_ARGS_EXIT)
+		}
+		if syncCompare != "mtime" && syncCompare != "sha1" {
+			return withExitCode(errors.New("--compare should be mtime or sha1!"), WRONG_ARGS_EXIT)
+		}
+		if syncHide && !dst.remote() {
+			return withExitCode(errors.New("--hide works only if dst is a bucket!"), WRONG_ARGS_EXIT)
+		}
+		if concurrency < 1 {
+			concurrency = 1
+		}
+
+		excludes := syncExcludes
+		for _, l := range []*location{src, dst} {
+			if !l.remote() {
+				excludes = append(excludes, readIgnoreFile(l.dir)...)
+			}
+		}
+		filter, err := newFileFilter(nil, excludes)
+		if err != nil {
+			return err
+		}
+
+		client, err := login()
+		if err != nil {
+			return err
+		}
+		for _, l := range []*location{src, dst} {
+			if l.remote() {
+				if l.bucket, err = getBucket(client, l.bucketName); err != nil {
+					return err
+				}
+			}
+		}
+
+		srcEntries, failures, err := listLocation(client, src, filter)
+		if err != nil {
+			return err
+		}
+		dstEntries, failed, err := listLocation(client, dst, filter)
+		if err != nil {
+			return err
+		}
+		failures = append(failures, failed...)
+
+		var changed, extraneous []string
+		for _, name := range sortedNames(srcEntries) {
+			if dstEntry, ok := dstEntries[name]; !ok || differs(srcEntries[name], dstEntry) {
+				changed = append(changed, name)
+			}
+		}
+		if syncDelete || syncHide {
+			for _, name := range sortedNames(dstEntries) {
+				if _, ok := srcEntries[name]; !ok {
+					extraneous = append(extraneous, name)
+				}
+			}
+		}
+
+		if syncDryRun {
+			action := "copy"
+			if !src.remote() {
+				action = "upload"
+			} else if !dst.remote() {
+				action = "download"
+			}
+			for _, name := range changed {
+				fmt.Fprintf(messageOutput(), "%s %s\n", action, name)
+			}
+
+			action = "delete"
+			if syncHide {
+				action = "hide"
+			}
+			for _, name := range extraneous {
+				fmt.Fprintf(messageOutput(), "%s %s\n", action, name)
+			}
+			fmt.Fprintf(messageOutput(), "Dry run, %d to copy, %d to remove from %s.\n", len(changed), len(extraneous), dst)
+			return nil
+		}
+
+		copied, failed := syncCopy(client, src, dst, srcEntries, changed)
+		failures = append(failures, failed...)
+
+		removed := 0
+		if len(extraneous) > 0 {
+			if failed, err = syncRemove(client, dst, dstEntries, extraneous); err != nil {
+				return err
+			}
+			removed = len(extraneous) - len(failed)
+			failures = append(failures, failed...)
+		}
+
+		fmt.Fprintf(messageOutput(), "Copied %d files, removed %d files, %d unchanged, %d failed.\n",
+			copied, removed, len(srcEntries)-len(changed), len(failures))
+		return failuresError(failures)
+	},
+}
+
+func init() {
+	syncCmd.Flags().StringVar(
+		&syncCompare,
+		"compare",
+		"mtime",
+		"compare files by size and mtime, or by size and sha1")
+	syncCmd.Flags().BoolVar(
+		&syncDelete,
+		"delete",
+		false,
+		"delete files of dst which are not in src, with all their versions")
+	syncCmd.Flags().BoolVar(
+		&syncHide,
+		"hide",
+		false,
+		"hide files of dst which are not in src")
+	syncCmd.Flags().BoolVar(
+		&syncDryRun,
+		"dry-run",
+		false,
+		"print the planned actions only")
+	syncCmd.Flags().StringArrayVar(
+		&syncExcludes,
+		"exclude",
+		nil,
+		"skip files and directories matching the glob pattern, can be repeated")
+	syncCmd.Flags().Int64VarP(
+		&concurrency,
+		"concurrency",
+		"c",
+		1,
+		"threads for syncing")
+	addLimitRateFlags(syncCmd)
+
+	rootCmd.AddCommand(syncCmd)
+}
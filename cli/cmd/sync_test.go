@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestParseLocation(t *testing.T) {
+	for _, check := range []struct {
+		s                  string
+		dir                string
+		bucketName, prefix string
+	}{
+		{".", ".", "", ""},
+		{"./", ".", "", ""},
+		{"/", "/", "", ""},
+		{"backup/photos/", "backup/photos", "", ""},
+		{"b2://photos", "", "photos", ""},
+		{"b2://photos/", "", "photos", ""},
+		{"b2://photos/2018", "", "photos", "2018/"},
+		{"b2://photos/2018/", "", "photos", "2018/"},
+	} {
+		l := parseLocation(check.s)
+		if l.dir != filepath.FromSlash(check.dir) || l.bucketName != check.bucketName || l.prefix != check.prefix {
+			t.Errorf("parseLocation(%q) = %+v", check.s, l)
+		}
+	}
+}
+
+func TestSyncToCurrentDir(t *testing.T) {
+	for _, dst := range []string{".", "./", "/"} {
+		dir := parseLocation(dst).dir
+		for _, name := range []string{"a.jpg", "2018/a.jpg"} {
+			filePath, ok := localPath(dir, "", name)
+			if !ok || filePath != filepath.Join(dir, filepath.FromSlash(name)) {
+				t.Errorf("%s should be synced to %s, got %q, %v", name, dst, filePath, ok)
+			}
+		}
+	}
+
+	if _, ok := localPath(parseLocation(".").dir, "", "../a.jpg"); ok {
+		t.Error("../a.jpg should not be synced to .")
+	}
+}
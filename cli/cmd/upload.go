@@ -1,10 +1,11 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"math"
 	"os"
-	"path"
+	"path/filepath"
 	"sync"
 
 	"github.com/hryyan/b2"
@@ -15,20 +16,10 @@ import (
 
 var concurrency int64 = 1
 
-func uploadFile(client *b2.B2, bucket *b2.Bucket, fileName, filePath string, size int64) {
-	var (
-		wg sync.WaitGroup
-		p  = mpb.New(mpb.WithWaitGroup(&wg))
-	)
+const PART_RETRIES = 3
 
-	uploadUrlToken, err := client.GetUploadUrl(bucket.BucketId)
-	if err != nil {
-		fmt.Println(err.Error())
-		os.Exit(B2_LIBRARY_ERROR_EXIT)
-	}
-
-	bar := p.AddBar(
-		size,
+func newBar(p *mpb.Progress, fileName string, size int64, options ...mpb.BarOption) *mpb.Bar {
+	options = append(options,
 		mpb.PrependDecorators(
 			decor.Name(fileName, decor.WC{W: len(fileName), C: decor.DidentRight}),
 			decor.Percentage(decor.WCSyncSpace),
@@ -41,82 +32,129 @@ func uploadFile(client *b2.B2, bucket *b2.Bucket, fileName, filePath string, siz
 			),
 		),
 	)
+	return p.AddBar(size, options...)
+}
 
-	go func() {
-		wg.Add(1)
-		defer wg.Done()
+// barListener show the aggregated progress of a transfer named name on bar.
+func barListener(bar *mpb.Bar, name string) b2.ProgressListener {
+	transferred := bytesListener(bar, name)
+	return b2.ProgressListenerFunc(func(event *b2.ProgressEvent) {
+		if event.Type == b2.TransferStarted && event.Total > 0 {
+			bar.SetTotal(event.Total, false)
+		}
+		transferred.OnProgress(event)
+	})
+}
 
-		var offset int64
-		if _, err = client.UploadFile(uploadUrlToken, filePath, func(done, total int64) {
-			bar.IncrBy(int(done - offset))
-			offset = done
-		}); err != nil {
-			fmt.Println(err.Error())
-			os.Exit(B2_LIBRARY_ERROR_EXIT)
+// bytesListener add transferred bytes to bar, the bytes of a failed transfer are taken back.
+// The progress is also printed as JSON lines named name with jsonProgress.
+func bytesListener(bar *mpb.Bar, name string) b2.ProgressListener {
+	var events b2.ProgressListener
+	if jsonProgress() {
+		events = progressEvents(name)
+	}
+	return b2.ProgressListenerFunc(func(event *b2.ProgressEvent) {
+		switch event.Type {
+		case b2.BytesTransferred, b2.PartRetried:
+			bar.IncrBy(int(event.Bytes))
+		case b2.TransferFailed:
+			bar.IncrBy(-int(event.Done))
+		}
+		if events != nil {
+			events.OnProgress(event)
 		}
-	}()
+	})
+}
+
+func uploadFile(client *b2.B2, bucket *b2.Bucket, fileName, filePath string, size int64) (*b2.File, error) {
+	uploadUrlToken, err := client.GetUploadUrl(bucket.BucketId)
+	if err != nil {
+		return nil, err
+	}
+
+	p := newProgress()
+	bar := newBar(p, fileName, size)
 
+	file, err := client.UploadFileAs(uploadUrlToken, filePath, fileName, barListener(bar, fileName))
+	if err != nil {
+		p.Abort(bar, false)
+	}
 	p.Wait()
+	return file, err
 }
 
-func uploadParts(client *b2.B2, bucket *b2.Bucket, fileName, filePath string, size, concurrency int64) {
+// uploadPart upload a part, retrying with a new upload url if it failed.
+func uploadPart(client *b2.B2, transfer *b2.Transfer, fileId, filePath string,
+	start, partSize, partNumber int64) (string, error) {
+	return retryPart(client, transfer, fileId, partNumber, func(uploadUrlToken *b2.UploadUrlToken) (string, error) {
+		return client.UploadPart(uploadUrlToken, filePath, start, partSize, partNumber, transfer)
+	})
+}
+
+// retryPart call upload with a new upload url until it successed or failed PART_RETRIES times.
+func retryPart(client *b2.B2, transfer *b2.Transfer, fileId string, partNumber int64,
+	upload func(*b2.UploadUrlToken) (string, error)) (string, error) {
+	var lastErr error
+	for i := 0; i < PART_RETRIES; i++ {
+		if lastErr != nil {
+			transfer.RetryPart(partNumber, lastErr)
+		}
+
+		uploadUrlToken, err := client.GetUploadPartUrl(fileId)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		contentSha1, err := upload(uploadUrlToken)
+		if err == nil {
+			return contentSha1, nil
+		}
+		lastErr = err
+	}
+	return "", lastErr
+}
+
+// uploadParts upload filePath in concurrency parts, the large file is canceled if any part failed.
+func uploadParts(client *b2.B2, bucket *b2.Bucket, fileName, filePath string, size, concurrency int64) (*b2.File, error) {
 	var (
 		start     int64 = 0
 		partSize  int64 = size / concurrency
 		sha1Array       = make([]string, concurrency)
 		i         int64 = 0
 
-		wg sync.WaitGroup
-		p  = mpb.New(mpb.WithWaitGroup(&wg))
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		lastErr error
+		p       = newProgress(mpb.WithWaitGroup(&wg))
 	)
 
 	file, err := client.StartLargeFile(bucket.BucketId, fileName, map[string]string{})
 	if err != nil {
-		fmt.Println(err.Error())
-		os.Exit(B2_LIBRARY_ERROR_EXIT)
+		return nil, err
 	}
 
-	for i = 0; i < concurrency; i++ {
-		uploadUrlToken, err := client.GetUploadPartUrl(file.FileId)
-		if err != nil {
-			fmt.Println(err.Error())
-			os.Exit(B2_LIBRARY_ERROR_EXIT)
-		}
+	bar := newBar(p, fileName, size)
+	transfer := b2.NewTransfer(fileName, size, barListener(bar, fileName))
+	transfer.Start()
 
+	for i = 0; i < concurrency; i++ {
 		if i == concurrency-1 {
 			partSize = size - partSize*i
 		}
 
-		bar := p.AddBar(
-			partSize,
-			mpb.PrependDecorators(
-				decor.Name(fileName, decor.WC{W: len(fileName), C: decor.DidentRight}),
-				decor.Percentage(decor.WCSyncSpace),
-			),
-			mpb.AppendDecorators(
-				decor.AverageSpeed(decor.UnitKiB, "% .2f "),
-				decor.Name("eta: ", decor.WC{W: 5}),
-				decor.OnComplete(
-					decor.AverageETA(decor.ET_STYLE_GO), "Done",
-				),
-			),
-		)
-
-		go func(start, pageSize, index int64) {
-			wg.Add(1)
+		wg.Add(1)
+		go func(start, partSize, index int64) {
 			defer wg.Done()
 
-			var offset int64
-			contentSha1, err := client.UploadPart(uploadUrlToken, filePath, start, partSize, index+1, func(done, total int64) {
-				bar.IncrBy(int(done - offset))
-				offset = done
-			})
+			contentSha1, err := uploadPart(client, transfer, file.FileId, filePath, start, partSize, index+1)
 
-			if err != nil {
-				fmt.Println(err.Error())
-				os.Exit(B2_LIBRARY_ERROR_EXIT)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil && lastErr == nil {
+				lastErr = err
+				p.Abort(bar, false)
 			}
-
 			sha1Array[index] = contentSha1
 		}(start, partSize, i)
 
@@ -125,39 +163,62 @@ func uploadParts(client *b2.B2, bucket *b2.Bucket, fileName, filePath string, si
 
 	p.Wait()
 
-	if _, err := client.FinishLargeFile(file.FileId, sha1Array); err != nil {
-		fmt.Println(err.Error())
-		os.Exit(B2_LIBRARY_ERROR_EXIT)
+	if lastErr != nil {
+		transfer.Finish(lastErr)
+		client.CancelLargeFile(file.FileId)
+		return nil, lastErr
 	}
+
+	file, err = client.FinishLargeFile(file.FileId, sha1Array)
+	transfer.Finish(err)
+	return file, err
 }
 
 var uploadFileCmd = &cobra.Command{
-	Use:   "upload bucket file",
-	Short: "Upload file",
-	Args:  cobra.ExactArgs(2),
-	Run: func(cmd *cobra.Command, args []string) {
+	Use:   "upload bucket file|dir",
+	Short: "Upload a file, or the files under a directory recursively",
+	Long: `Upload a file, or the files under a directory recursively.
+Use "upload bucket name -" to upload stdin as name, such as:
+tar c dir | b2 upload bucket backup.tar -`,
+	Args: cobra.RangeArgs(2, 3),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if concurrency < 1 {
+			concurrency = 1
+		}
+
+		if len(args) == 3 {
+			if args[2] != STDIO {
+				return withExitCode(fmt.Errorf("Use %s to upload stdin as %s!", STDIO, args[1]), WRONG_ARGS_EXIT)
+			}
+			client, bucket, err := loginBucket(args[0])
+			if err != nil {
+				return err
+			}
+			return uploadStream(client, bucket, uploadPrefix+args[1], os.Stdin, concurrency)
+		}
+
 		var (
 			bucketName = args[0]
-			fileName   = args[1]
-			filePath   = ""
+			filePath   = filepath.Clean(args[1])
+			fileName   = uploadPrefix + filepath.Base(filePath)
 		)
 
-		if path.IsAbs(fileName) {
-			filePath = fileName
-			fileName = path.Base(filePath)
-		} else {
-			filePath = path.Join(".", fileName)
-		}
-
 		info, err := os.Stat(filePath)
 		if err != nil {
-			fmt.Println("Read file info error!")
-			os.Exit(OPERATION_ERROR_EXIT)
+			return withExitCode(errors.New("Read file info error!"), OPERATION_ERROR_EXIT)
 		}
 		size := info.Size()
 
-		if concurrency < 1 {
-			concurrency = 1
+		if info.IsDir() {
+			filter, err := newFileFilter(uploadIncludes, uploadExcludes)
+			if err != nil {
+				return err
+			}
+			client, bucket, err := loginBucket(bucketName)
+			if err != nil {
+				return err
+			}
+			return uploadDir(client, bucket, filePath, concurrency, filter)
 		}
 
 		minPart, maxPart := 5000000.0, 500000000.0
@@ -165,34 +226,34 @@ var uploadFileCmd = &cobra.Command{
 		suggestConcurrency := int64(math.Ceil(float64(size) / 100000000.0))
 
 		if part < minPart {
-			fmt.Println("Below min part size(5M), auto set part size to 100M!")
-			fmt.Println("Set concurrency to ", suggestConcurrency)
+			fmt.Fprintln(messageOutput(), "Below min part size(5M), auto set part size to 100M!")
+			fmt.Fprintln(messageOutput(), "Set concurrency to ", suggestConcurrency)
 			concurrency = suggestConcurrency
 		} else if part > maxPart {
-			fmt.Println("Above max part size(500M), auto set part size to 100M!")
-			fmt.Println("Set concurrency to ", suggestConcurrency)
+			fmt.Fprintln(messageOutput(), "Above max part size(500M), auto set part size to 100M!")
+			fmt.Fprintln(messageOutput(), "Set concurrency to ", suggestConcurrency)
 			concurrency = suggestConcurrency
 		}
-
-		client := login()
-		buckets, err := client.ListBuckets("", bucketName, "")
-		if err != nil {
-			fmt.Println(err.Error())
-			os.Exit(B2_LIBRARY_ERROR_EXIT)
+		if concurrency < 1 {
+			// an empty file is uploaded at once
+			concurrency = 1
 		}
 
-		if len(buckets) != 1 {
-			fmt.Printf("Can not find bucket %s!\n", bucketName)
-			os.Exit(OPERATION_ERROR_EXIT)
+		client, bucket, err := loginBucket(bucketName)
+		if err != nil {
+			return err
 		}
 
-		bucket := buckets[0]
-
+		var file *b2.File
 		if concurrency == 1 {
-			uploadFile(client, bucket, fileName, filePath, size)
+			file, err = uploadFile(client, bucket, fileName, filePath, size)
 		} else {
-			uploadParts(client, bucket, fileName, filePath, size, concurrency)
+			file, err = uploadParts(client, bucket, fileName, filePath, size, concurrency)
+		}
+		if err != nil {
+			return withExitCode(err, B2_LIBRARY_ERROR_EXIT)
 		}
+		return printResult(file, nil)
 	},
 }
 
@@ -203,6 +264,22 @@ func init() {
 		"c",
 		1,
 		"threads for uploading")
+	uploadFileCmd.Flags().StringVar(
+		&uploadPrefix,
+		"prefix",
+		"",
+		"prefix of the uploaded file names, such as site/")
+	uploadFileCmd.Flags().StringArrayVar(
+		&uploadIncludes,
+		"include",
+		nil,
+		"upload only files matching the glob pattern, can be repeated")
+	uploadFileCmd.Flags().StringArrayVar(
+		&uploadExcludes,
+		"exclude",
+		nil,
+		"skip files and directories matching the glob pattern, can be repeated")
+	addLimitRateFlags(uploadFileCmd)
 
 	rootCmd.AddCommand(uploadFileCmd)
 }
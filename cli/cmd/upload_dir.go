@@ -0,0 +1,306 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/hryyan/b2"
+	"github.com/vbauerster/mpb"
+)
+
+const MAX_PART_COUNT = 10000
+
+var (
+	uploadPrefix   string
+	uploadIncludes []string
+	uploadExcludes []string
+)
+
+// uploadJob is a local file and the name it is uploaded as.
+type uploadJob struct {
+	filePath string
+	fileName string
+	size     int64
+	modTime  int64
+}
+
+// uploadWorker run tasks of a dirUpload, it keeps an upload url
+// for small files as b2 wants an upload url per thread.
+type uploadWorker struct {
+	uploadUrlToken *b2.UploadUrlToken
+}
+
+// dirUpload upload a directory with a pool of workers shared by small files and parts.
+type dirUpload struct {
+	client   *b2.B2
+	bucket   *b2.Bucket
+	partSize int64
+
+	p         *mpb.Progress
+	total     *mpb.Bar
+	totalName string
+	tasks     chan func(*uploadWorker)
+	wg        sync.WaitGroup
+
+	mu       sync.Mutex
+	uploaded int
+	failures []string
+}
+
+// walkDir collect the files under root which match filter.
+func walkDir(root, prefix string, filter *fileFilter) ([]*uploadJob, []string) {
+	var (
+		jobs     []*uploadJob
+		failures []string
+	)
+
+	filepath.Walk(root, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %s", filePath, err.Error()))
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, filePath)
+		if err != nil || rel == "." {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+
+		if info.IsDir() {
+			if filter.Excluded(rel) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() || !filter.Match(rel) {
+			return nil
+		}
+
+		jobs = append(jobs, &uploadJob{
+			filePath: filePath,
+			fileName: prefix + rel,
+			size:     info.Size(),
+			modTime:  info.ModTime().Unix() * 1000,
+		})
+		return nil
+	})
+	return jobs, failures
+}
+
+func (u *dirUpload) succeed() {
+	u.mu.Lock()
+	u.uploaded++
+	u.mu.Unlock()
+}
+
+func (u *dirUpload) fail(fileName string, err error) {
+	u.mu.Lock()
+	u.failures = append(u.failures, fmt.Sprintf("%s: %s", fileName, err.Error()))
+	u.mu.Unlock()
+}
+
+// fileBar return a bar removed on completion, nil for empty files.
+func (u *dirUpload) fileBar(job *uploadJob) *mpb.Bar {
+	if job.size == 0 {
+		return nil
+	}
+	return newBar(u.p, job.fileName, job.size, mpb.BarRemoveOnComplete())
+}
+
+func (u *dirUpload) listener(job *uploadJob, bar *mpb.Bar) b2.ProgressListener {
+	totalListener := bytesListener(u.total, u.totalName)
+	if bar == nil {
+		return totalListener
+	}
+	fileListener := barListener(bar, job.fileName)
+	return b2.ProgressListenerFunc(func(event *b2.ProgressEvent) {
+		fileListener.OnProgress(event)
+		totalListener.OnProgress(event)
+	})
+}
+
+func (u *dirUpload) abort(bar *mpb.Bar) {
+	if bar != nil {
+		u.p.Abort(bar, true)
+	}
+}
+
+// uploadSmall upload a file in one request, retrying with a new upload url if it failed.
+func (u *dirUpload) uploadSmall(w *uploadWorker, job *uploadJob) {
+	var (
+		bar     = u.fileBar(job)
+		lastErr error
+	)
+
+	for i := 0; i < PART_RETRIES; i++ {
+		if w.uploadUrlToken == nil {
+			uploadUrlToken, err := u.client.GetUploadUrl(u.bucket.BucketId)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			w.uploadUrlToken = uploadUrlToken
+		}
+
+		_, err := u.client.UploadFileAs(w.uploadUrlToken, job.filePath, job.fileName, u.listener(job, bar))
+		if err == nil {
+			u.succeed()
+			return
+		}
+		lastErr = err
+		w.uploadUrlToken = nil
+	}
+
+	u.abort(bar)
+	u.fail(job.fileName, lastErr)
+}
+
+// scheduleLarge start a large file and queue its parts, the file is finished
+// after all parts are uploaded, or canceled if any part failed.
+func (u *dirUpload) scheduleLarge(job *uploadJob) {
+	fileInfo := map[string]string{"src_last_modified_millis": fmt.Sprintf("%d", job.modTime)}
+	file, err := u.client.StartLargeFile(u.bucket.BucketId, job.fileName, fileInfo)
+	if err != nil {
+		u.fail(job.fileName, err)
+		return
+	}
+
+	partSize := u.partSize
+	if job.size > partSize*MAX_PART_COUNT {
+		partSize = (job.size + MAX_PART_COUNT - 1) / MAX_PART_COUNT
+	}
+	count := (job.size + partSize - 1) / partSize
+
+	var (
+		bar       = u.fileBar(job)
+		transfer  = b2.NewTransfer(job.fileName, job.size, u.listener(job, bar))
+		sha1Array = make([]string, count)
+		parts     sync.WaitGroup
+		mu        sync.Mutex
+		partErr   error
+	)
+	transfer.Start()
+
+	for i := int64(0); i < count; i++ {
+		start, size := i*partSize, partSize
+		if i == count-1 {
+			size = job.size - start
+		}
+
+		parts.Add(1)
+		index := i
+		u.tasks <- func(w *uploadWorker) {
+			defer parts.Done()
+
+			mu.Lock()
+			failed := partErr != nil
+			mu.Unlock()
+			if failed {
+				return
+			}
+
+			contentSha1, err := uploadPart(u.client, transfer, file.FileId, job.filePath, start, size, index+1)
+			mu.Lock()
+			if err != nil && partErr == nil {
+				partErr = err
+			}
+			sha1Array[index] = contentSha1
+			mu.Unlock()
+		}
+	}
+
+	u.wg.Add(1)
+	go func() {
+		defer u.wg.Done()
+		parts.Wait()
+
+		err := partErr
+		if err == nil {
+			_, err = u.client.FinishLargeFile(file.FileId, sha1Array)
+		}
+		transfer.Finish(err)
+
+		if err != nil {
+			u.client.CancelLargeFile(file.FileId)
+			u.abort(bar)
+			u.fail(job.fileName, err)
+			return
+		}
+		u.succeed()
+	}()
+}
+
+// uploadAll upload jobs with a pool of workers,
+// it return the number of uploaded files and the failures.
+func uploadAll(client *b2.B2, bucket *b2.Bucket, jobs []*uploadJob, workers int64) (int, []string) {
+	var totalSize int64
+	for _, job := range jobs {
+		totalSize += job.size
+	}
+
+	auth := client.GetAuth()
+	u := &dirUpload{
+		client:   client,
+		bucket:   bucket,
+		partSize: auth.RecommendedPartSize,
+		p:        newProgress(),
+		tasks:    make(chan func(*uploadWorker)),
+	}
+	if u.partSize < auth.AbsoluteMinimumPartSize {
+		u.partSize = auth.AbsoluteMinimumPartSize
+	}
+	u.totalName = fmt.Sprintf("%d files", len(jobs))
+	u.total = newBar(u.p, u.totalName, totalSize)
+
+	var pool sync.WaitGroup
+	for i := int64(0); i < workers; i++ {
+		pool.Add(1)
+		go func() {
+			defer pool.Done()
+
+			w := &uploadWorker{}
+			for task := range u.tasks {
+				task(w)
+			}
+		}()
+	}
+
+	for _, job := range jobs {
+		if job.size > u.partSize {
+			u.scheduleLarge(job)
+			continue
+		}
+
+		job := job
+		u.tasks <- func(w *uploadWorker) {
+			u.uploadSmall(w, job)
+		}
+	}
+	close(u.tasks)
+
+	pool.Wait()
+	u.wg.Wait()
+	if len(u.failures) > 0 || totalSize == 0 {
+		u.p.Abort(u.total, false)
+	}
+	u.p.Wait()
+
+	return u.uploaded, u.failures
+}
+
+// uploadDir upload the files under root as prefix + relative path.
+func uploadDir(client *b2.B2, bucket *b2.Bucket, root string, workers int64, filter *fileFilter) error {
+	jobs, failures := walkDir(root, uploadPrefix, filter)
+	uploaded, failed := uploadAll(client, bucket, jobs, workers)
+	failures = append(failures, failed...)
+
+	err := printResult(&transferSummary{Transferred: uploaded, Failures: failures}, func() {
+		fmt.Printf("Uploaded %d files, %d failed.\n", uploaded, len(failures))
+	})
+	if err != nil {
+		return err
+	}
+	return failuresError(failures)
+}
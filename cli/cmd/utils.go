@@ -1,93 +1,289 @@
 package cmd
 
 import (
-	"encoding/json"
+	"bufio"
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
 	"github.com/hryyan/b2"
 )
 
-type Login struct {
-	b2.AuthResponse
-	ExpiredAt int64 `json:"expiredAt"`
+func login() (*b2.B2, error) {
+	limiter, err := rateLimiter()
+	if err != nil {
+		return nil, err
+	}
+
+	provider := b2.DefaultProviderChain("", "", viper.GetString("profile"))
+	b, err := b2.NewB2(provider)
+	if err != nil {
+		return nil, withExitCode(err, AUTH_ERROR_EXIT)
+	}
+
+	removeOldSession()
+	session, err := readSession(b.KeyId)
+	if err != nil {
+		return nil, err
+	}
+	if session.valid(b) {
+		b.SetAuth(session.AuthResponse)
+	} else if err = authorize(b); err != nil {
+		return nil, err
+	}
+
+	if b.Observer != nil {
+		b.Observer = b2.MultiObserver(b.Observer, sessionObserver(b.KeyId))
+	} else {
+		b.Observer = sessionObserver(b.KeyId)
+	}
+	b.Limiter = limiter
+
+	return b, nil
 }
 
-type Session struct {
-	Login `json:"login"`
+// authorize authorize b and cache the session. Processes starting together wait for
+// the first one to authorize and use its session.
+func authorize(b *b2.B2) error {
+	unlock, err := lockSession(b.KeyId, SESSION_LOCK_TIMEOUT)
+	if err != nil {
+		return withExitCode(err, WRITE_SESSION_ERROR_EXIT)
+	}
+	defer unlock()
+
+	session, err := readSession(b.KeyId)
+	if err != nil {
+		return err
+	}
+	if session.valid(b) {
+		b.SetAuth(session.AuthResponse)
+		return nil
+	}
+
+	if err = b.Auth(); err != nil {
+		removeSession(b.KeyId)
+		return withExitCode(err, AUTH_ERROR_EXIT)
+	}
+	return writeSession(&Session{Login{
+		AuthResponse: b.GetAuth(),
+		KeyId:        b.KeyId,
+		KeyHash:      keyHash(b),
+		ExpiredAt:    time.Now().Add(SESSION_TTL).Unix(),
+	}})
 }
 
-func login() *b2.B2 {
-	var (
-		accountId      = viper.GetString("B2_ACCOUNT_ID")
-		applicationKey = viper.GetString("B2_APPLICATION_KEY")
-		b              = &b2.B2{
-			AccountId:      accountId,
-			ApplicationKey: applicationKey,
-		}
-	)
+// getBucket return the bucket named bucketName.
+func getBucket(client *b2.B2, bucketName string) (*b2.Bucket, error) {
+	buckets, err := client.ListBuckets("", bucketName, "")
+	if err != nil {
+		return nil, withExitCode(err, B2_LIBRARY_ERROR_EXIT)
+	}
 
-	session := readSession()
-	if session == nil {
-		session = &Session{}
+	if len(buckets) != 1 {
+		return nil, withExitCode(fmt.Errorf("Can not find bucket %s!", bucketName), NOT_FOUND_EXIT)
 	}
 
-	if time.Now().Before(time.Unix(session.ExpiredAt, 0)) {
-		b.SetAuth(session.AuthResponse)
-	} else {
-		if err := b.Auth(); err != nil {
-			fmt.Println("Auth error!")
-			os.Exit(AUTH_ERROR_EXIT)
+	return buckets[0], nil
+}
+
+// loginBucket log in and return the bucket named bucketName.
+func loginBucket(bucketName string) (*b2.B2, *b2.Bucket, error) {
+	client, err := login()
+	if err != nil {
+		return nil, nil, err
+	}
+	bucket, err := getBucket(client, bucketName)
+	return client, bucket, err
+}
+
+// stdin is shared by the prompts, a reader per prompt would lose the input it buffered.
+var stdin = bufio.NewReader(os.Stdin)
+
+// confirm ask a y / n question on stdin.
+func confirm(question string) bool {
+	for {
+		fmt.Fprintf(messageOutput(), "%s Type y / n\n", question)
+		text, err := stdin.ReadString('\n')
+		text = strings.TrimSpace(text)
+		if text == "y" {
+			return true
+		} else if text == "n" || err != nil {
+			return false
 		} else {
-			session.AuthResponse = b.GetAuth()
-			session.ExpiredAt = time.Now().Add(24 * time.Hour).Unix()
-			writeSession(session)
+			fmt.Fprintln(messageOutput(), "Please type y / n")
+		}
+	}
+}
+
+// confirmName ask to type name on stdin, for operations which can not be undone.
+func confirmName(question, name string) bool {
+	fmt.Fprintf(messageOutput(), "%s Type %s to confirm\n", question, name)
+	text, _ := stdin.ReadString('\n')
+	return strings.TrimSpace(text) == name
+}
+
+// parseDuration parse durations like 90s, 12h or 7d.
+func parseDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.ParseFloat(strings.TrimSuffix(s, "d"), 64)
+		if err != nil || days < 0 {
+			return 0, fmt.Errorf("Invalid duration %s!", s)
 		}
+		return time.Duration(days * float64(24*time.Hour)), nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("Invalid duration %s!", s)
 	}
+	return d, nil
+}
 
-	return b
+var (
+	limitRate     string
+	limitBurst    string
+	limitSchedule string
+)
+
+func addLimitRateFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(
+		&limitRate,
+		"limit-rate",
+		"",
+		"max bandwidth shared by all transfers, such as 500K, 10M")
+	cmd.Flags().StringVar(
+		&limitBurst,
+		"limit-burst",
+		"",
+		"max burst size, defaults to one second of traffic")
+	cmd.Flags().StringVar(
+		&limitSchedule,
+		"limit-schedule",
+		"",
+		"bandwidth by time of day, such as 08:00-18:00=1M,18:00-08:00=0")
 }
 
-func writeSession(session *Session) {
-	f, err := os.Create(sessionPath)
+func rateLimiter() (*b2.RateLimiter, error) {
+	if limitRate == "" && limitSchedule == "" {
+		return nil, nil
+	}
+
+	rate, err := parseSize(limitRate)
 	if err != nil {
-		fmt.Println("Create session file error!")
-		os.Exit(CREATE_SESSION_ERROR_EXIT)
+		return nil, withExitCode(err, WRONG_ARGS_EXIT)
 	}
 
-	b, err := json.MarshalIndent(session, "", "    ")
+	burst, err := parseSize(limitBurst)
 	if err != nil {
-		fmt.Println("Encode session file error!")
-		os.Exit(ENCODE_SESSION_ERROR_EXIT)
+		return nil, withExitCode(err, WRONG_ARGS_EXIT)
 	}
 
-	if _, err = f.Write(b); err != nil {
-		fmt.Println("Write session file error!")
-		os.Exit(WRITE_SESSION_ERROR_EXIT)
+	schedule, err := parseSchedule(limitSchedule)
+	if err != nil {
+		return nil, withExitCode(err, WRONG_ARGS_EXIT)
 	}
+
+	limiter := b2.NewRateLimiter(rate, burst)
+	limiter.SetSchedule(schedule)
+	return limiter, nil
 }
 
-func readSession() *Session {
-	f, err := os.Open(sessionPath)
-	if err != nil {
-		fmt.Println("Read session file error!")
-		os.Exit(READ_SESSION_ERROR_EXIT)
+// parseSize parse sizes like 512, 100K, 10M or 1G, units are powers of 1024.
+func parseSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
 	}
 
-	b, err := ioutil.ReadAll(f)
-	if err != nil {
-		fmt.Println("Read session file error!")
-		os.Exit(READ_SESSION_ERROR_EXIT)
+	var (
+		unit   int64 = 1
+		number       = s
+	)
+	switch strings.ToUpper(s[len(s)-1:]) {
+	case "K":
+		unit = 1 << 10
+	case "M":
+		unit = 1 << 20
+	case "G":
+		unit = 1 << 30
+	}
+	if unit != 1 {
+		number = s[:len(s)-1]
 	}
 
-	var session Session
-	if err = json.Unmarshal(b, &session); err != nil {
-		return nil
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("Invalid size %s!", s)
+	}
+	return int64(n * float64(unit)), nil
+}
+
+// humanSize format sizes like parseSize, such as 512, 1.5K or 10.0M.
+func humanSize(n int64) string {
+	if n < 1<<10 {
+		return strconv.FormatInt(n, 10)
+	}
+
+	size, unit := float64(n)/(1<<10), "K"
+	for _, next := range []string{"M", "G", "T"} {
+		if size < 1<<10 {
+			break
+		}
+		size, unit = size/(1<<10), next
+	}
+	return fmt.Sprintf("%.1f%s", size, unit)
+}
+
+// parseSchedule parse schedules like 08:00-18:00=1M,18:00-08:00=0.
+func parseSchedule(s string) ([]b2.RateWindow, error) {
+	var schedule []b2.RateWindow
+	if strings.TrimSpace(s) == "" {
+		return schedule, nil
+	}
+
+	for _, item := range strings.Split(s, ",") {
+		parts := strings.SplitN(strings.TrimSpace(item), "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Invalid schedule %s!", item)
+		}
+		times := strings.SplitN(parts[0], "-", 2)
+		if len(times) != 2 {
+			return nil, fmt.Errorf("Invalid schedule %s!", item)
+		}
+
+		start, err := parseTimeOfDay(times[0])
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseTimeOfDay(times[1])
+		if err != nil {
+			return nil, err
+		}
+		rate, err := parseSize(parts[1])
+		if err != nil {
+			return nil, err
+		}
+
+		schedule = append(schedule, b2.RateWindow{
+			Start:          start,
+			End:            end,
+			BytesPerSecond: rate,
+		})
 	}
+	return schedule, nil
+}
 
-	return &session
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, errors.New("Invalid time of day " + s + "!")
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
 }
@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestPrompts(t *testing.T) {
+	reader := stdin
+	t.Cleanup(func() { stdin = reader })
+
+	// the answers are read at once, as they are when piped
+	stdin = bufio.NewReader(strings.NewReader("maybe\ny\nlogs\nn\nphotos\n"))
+	if !confirm("Delete?") {
+		t.Fatal("Should confirm after y")
+	}
+	if !confirmName("Delete bucket?", "logs") {
+		t.Fatal("Should confirm the name logs")
+	}
+	if confirm("Delete?") {
+		t.Fatal("Should not confirm after n")
+	}
+	if confirmName("Delete bucket?", "logs") {
+		t.Fatal("Should not confirm the name photos")
+	}
+	if confirm("Delete?") {
+		t.Fatal("Should not confirm at the end of input")
+	}
+}
@@ -10,8 +10,9 @@ const VERSION = "0.2.0"
 
 var versionCmd = &cobra.Command{
 	Use: "version",
-	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println(VERSION)
+	RunE: func(cmd *cobra.Command, args []string) error {
+		fmt.Fprintln(messageOutput(), VERSION)
+		return nil
 	},
 }
 
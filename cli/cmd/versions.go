@@ -0,0 +1,217 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/hryyan/b2"
+	"github.com/spf13/cobra"
+)
+
+var (
+	restoreAsOf    string
+	restoreHideNew bool
+	restoreDryRun  bool
+)
+
+// fileVersions return the versions of exactly fileName, newest first.
+func fileVersions(client *b2.B2, bucket *b2.Bucket, fileName string) ([]*b2.File, error) {
+	all, err := listVersions(client, bucket.BucketId, fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []*b2.File
+	for _, version := range all {
+		if version.FileName == fileName {
+			versions = append(versions, version)
+		}
+	}
+	return versions, nil
+}
+
+func formatMillis(millis int64) string {
+	return time.Unix(0, millis*int64(time.Millisecond)).Format(time.RFC3339)
+}
+
+var versionsCmd = &cobra.Command{
+	Use:   "versions bucket file",
+	Short: "List all versions of a file, newest first",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, bucket, err := loginBucket(args[0])
+		if err != nil {
+			return err
+		}
+
+		versions, err := fileVersions(client, bucket, args[1])
+		if err != nil {
+			return err
+		}
+		if len(versions) == 0 {
+			return withExitCode(fmt.Errorf("Can not find %s in %s!", args[1], args[0]), NOT_FOUND_EXIT)
+		}
+
+		return printResults(versions, func() {
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			for _, version := range versions {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n",
+					version.Action, humanSize(version.ContentLength), formatMillis(version.UploadTimestamp), version.FileId)
+			}
+			w.Flush()
+		})
+	},
+}
+
+var hideCmd = &cobra.Command{
+	Use:   "hide bucket file [file ..]",
+	Short: "Hide files, their versions are kept",
+	Args:  cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, bucket, err := loginBucket(args[0])
+		if err != nil {
+			return err
+		}
+
+		for _, fileName := range args[1:] {
+			if err = client.HideFile(bucket.BucketId, fileName); err != nil {
+				return withExitCode(err, B2_LIBRARY_ERROR_EXIT)
+			}
+			fmt.Fprintf(messageOutput(), "Hide %s successed!\n", fileName)
+		}
+		return nil
+	},
+}
+
+var unhideCmd = &cobra.Command{
+	Use:   "unhide bucket file [file ..]",
+	Short: "Unhide files by deleting their hide markers",
+	Args:  cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, bucket, err := loginBucket(args[0])
+		if err != nil {
+			return err
+		}
+
+		for _, fileName := range args[1:] {
+			versions, err := fileVersions(client, bucket, fileName)
+			if err != nil {
+				return err
+			}
+			if len(versions) == 0 || versions[0].Action != "hide" {
+				return withExitCode(fmt.Errorf("%s is not hidden!", fileName), OPERATION_ERROR_EXIT)
+			}
+
+			if err = client.DeleteFileVersion(versions[0].FileName, versions[0].FileId); err != nil {
+				return withExitCode(err, B2_LIBRARY_ERROR_EXIT)
+			}
+			fmt.Fprintf(messageOutput(), "Unhide %s successed!\n", fileName)
+		}
+		return nil
+	},
+}
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore bucket prefix",
+	Short: "Make the versions current at a time the latest versions again",
+	Long: `Restore the files under prefix to the versions current at --as-of by
+copying them on the server side, newer versions are kept in the history.
+Files created after --as-of are hidden with --hide-new.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		asOf, err := parseAsOf(restoreAsOf)
+		if err != nil {
+			return err
+		}
+		if concurrency < 1 {
+			concurrency = 1
+		}
+
+		client, bucket, err := loginBucket(args[0])
+		if err != nil {
+			return err
+		}
+		versions, err := listVersions(client, bucket.BucketId, args[1])
+		if err != nil {
+			return err
+		}
+
+		var (
+			latest  = map[string]*b2.File{}
+			targets = map[string]*b2.File{}
+			names   []string
+		)
+		for _, version := range versions {
+			if _, ok := latest[version.FileName]; !ok {
+				latest[version.FileName] = version
+				names = append(names, version.FileName)
+			}
+		}
+		for _, version := range filesAsOf(versions, asOf) {
+			targets[version.FileName] = version
+		}
+
+		var copies, hides []string
+		for _, name := range names {
+			target, ok := targets[name]
+			switch {
+			case ok && target.FileId != latest[name].FileId:
+				copies = append(copies, name)
+			case !ok && restoreHideNew && latest[name].Action == "upload":
+				hides = append(hides, name)
+			}
+		}
+
+		if restoreDryRun {
+			for _, name := range copies {
+				fmt.Fprintf(messageOutput(), "restore %s (%s, %s)\n", name, targets[name].FileId, formatMillis(targets[name].UploadTimestamp))
+			}
+			for _, name := range hides {
+				fmt.Fprintf(messageOutput(), "hide %s\n", name)
+			}
+			fmt.Fprintf(messageOutput(), "Dry run, %d files to restore, %d files to hide.\n", len(copies), len(hides))
+			return nil
+		}
+
+		failures := forEach(concurrency, copies, func(name string) error {
+			_, err := client.CopyFile(targets[name].FileId, "", name)
+			return err
+		})
+		failures = append(failures, forEach(concurrency, hides, func(name string) error {
+			return client.HideFile(bucket.BucketId, name)
+		})...)
+
+		fmt.Fprintf(messageOutput(), "Done, %d files restored or hidden, %d failed.\n",
+			len(copies)+len(hides)-len(failures), len(failures))
+		return failuresError(failures)
+	},
+}
+
+func init() {
+	restoreCmd.Flags().StringVar(
+		&restoreAsOf,
+		"as-of",
+		"",
+		"time to restore to, such as 2018-06-01T08:00Z")
+	restoreCmd.Flags().BoolVar(
+		&restoreHideNew,
+		"hide-new",
+		false,
+		"hide the files created after --as-of")
+	restoreCmd.Flags().BoolVar(
+		&restoreDryRun,
+		"dry-run",
+		false,
+		"print the planned actions only")
+	restoreCmd.Flags().Int64VarP(
+		&concurrency,
+		"concurrency",
+		"c",
+		1,
+		"threads for restoring")
+	restoreCmd.MarkFlagRequired("as-of")
+
+	rootCmd.AddCommand(versionsCmd, hideCmd, unhideCmd, restoreCmd)
+}
@@ -0,0 +1,248 @@
+// Copyright 2018 hryyan. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package b2
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// DEFAULT_PROFILE is the profile used when no profile is specified.
+const DEFAULT_PROFILE = "default"
+
+var ErrNoCredentials = errors.New("No b2 credentials found")
+
+// Credentials is an application key id and its application key.
+type Credentials struct {
+	KeyId          string `json:"applicationKeyId"`
+	ApplicationKey string `json:"applicationKey"`
+	// Source describes where the credentials come from, such as "env".
+	Source string `json:"-"`
+}
+
+// CredentialsProvider retrieves credentials.
+// Retrieve return ErrNoCredentials if the provider has nothing to offer,
+// so that a ChainProvider can go on with the next one.
+type CredentialsProvider interface {
+	Retrieve() (*Credentials, error)
+}
+
+// StaticProvider provides explicit credentials.
+type StaticProvider struct {
+	KeyId          string
+	ApplicationKey string
+}
+
+func (p *StaticProvider) Retrieve() (*Credentials, error) {
+	if p.KeyId == "" || p.ApplicationKey == "" {
+		return nil, ErrNoCredentials
+	}
+	return &Credentials{p.KeyId, p.ApplicationKey, "static"}, nil
+}
+
+// EnvProvider reads B2_APPLICATION_KEY_ID (or the older B2_ACCOUNT_ID) and B2_APPLICATION_KEY.
+type EnvProvider struct{}
+
+func (p *EnvProvider) Retrieve() (*Credentials, error) {
+	keyId, applicationKey := GetKeyFromEnv()
+	if keyId == "" || applicationKey == "" {
+		return nil, ErrNoCredentials
+	}
+	return &Credentials{keyId, applicationKey, "env"}, nil
+}
+
+// FileProvider reads a profile from a credentials file like:
+//
+//	[default]
+//	application_key_id = 000xxxxxxxxxxxx0000000001
+//	application_key = K000xxxxxxxxxxxxxxxxxxxxxxxxxxx
+//
+//	[staging]
+//	credential_process = pass show b2/staging.json
+//
+// A profile with credential_process is resolved by a CommandProvider,
+// so the command must print the credentials as json.
+type FileProvider struct {
+	// Path defaults to DefaultCredentialsPath().
+	Path string
+	// Profile defaults to DEFAULT_PROFILE.
+	Profile string
+}
+
+// DefaultCredentialsPath return $XDG_CONFIG_HOME/b2/credentials,
+// or ~/.config/b2/credentials if XDG_CONFIG_HOME is not set.
+func DefaultCredentialsPath() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "b2", "credentials")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "b2", "credentials")
+}
+
+func (p *FileProvider) Retrieve() (*Credentials, error) {
+	path, profile := p.Path, p.Profile
+	if path == "" {
+		path = DefaultCredentialsPath()
+	}
+	if profile == "" {
+		profile = DEFAULT_PROFILE
+	}
+
+	profiles, err := ReadProfiles(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNoCredentials
+	} else if err != nil {
+		return nil, err
+	}
+
+	values, ok := profiles[profile]
+	if !ok {
+		if p.Profile != "" {
+			return nil, fmt.Errorf("Profile %s not found in %s", profile, path)
+		}
+		return nil, ErrNoCredentials
+	}
+
+	if command := values["credential_process"]; command != "" {
+		return (&CommandProvider{Command: command}).Retrieve()
+	}
+
+	credentials := &Credentials{
+		KeyId:          values["application_key_id"],
+		ApplicationKey: values["application_key"],
+		Source:         "profile " + profile,
+	}
+	if credentials.KeyId == "" || credentials.ApplicationKey == "" {
+		return nil, fmt.Errorf("Profile %s in %s is incomplete", profile, path)
+	}
+	return credentials, nil
+}
+
+// ReadProfiles parse a credentials file into values by profile name.
+func ReadProfiles(path string) (map[string]map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		profiles = map[string]map[string]string{}
+		current  map[string]string
+		scanner  = bufio.NewScanner(f)
+		lineNo   = 0
+	)
+
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";"):
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			if _, ok := profiles[name]; !ok {
+				profiles[name] = map[string]string{}
+			}
+			current = profiles[name]
+		default:
+			parts := strings.SplitN(line, "=", 2)
+			if len(parts) != 2 || current == nil {
+				return nil, fmt.Errorf("%s:%d: invalid line", path, lineNo)
+			}
+			current[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return profiles, nil
+}
+
+// CommandProvider runs an external command which prints credentials as json:
+//
+//	{"applicationKeyId": "...", "applicationKey": "..."}
+type CommandProvider struct {
+	Command string
+}
+
+func (p *CommandProvider) Retrieve() (*Credentials, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", p.Command)
+	} else {
+		cmd = exec.Command("sh", "-c", p.Command)
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("Credential process failed: %s %s", err.Error(), strings.TrimSpace(stderr.String()))
+	}
+
+	var credentials Credentials
+	if err = json.Unmarshal(output, &credentials); err != nil {
+		return nil, fmt.Errorf("Credential process printed invalid json: %s", err.Error())
+	}
+	if credentials.KeyId == "" || credentials.ApplicationKey == "" {
+		return nil, errors.New("Credential process printed incomplete credentials")
+	}
+	credentials.Source = "command"
+	return &credentials, nil
+}
+
+// ChainProvider asks providers in order and return the first credentials found.
+type ChainProvider []CredentialsProvider
+
+func (c ChainProvider) Retrieve() (*Credentials, error) {
+	for _, provider := range c {
+		credentials, err := provider.Retrieve()
+		if err == ErrNoCredentials {
+			continue
+		}
+		return credentials, err
+	}
+	return nil, ErrNoCredentials
+}
+
+// DefaultProviderChain return the chain of explicit values, environment variables
+// and the default credentials file. If profile is not empty, only the profile is used.
+func DefaultProviderChain(keyId, applicationKey, profile string) CredentialsProvider {
+	if profile != "" {
+		return ChainProvider{
+			&StaticProvider{keyId, applicationKey},
+			&FileProvider{Profile: profile},
+		}
+	}
+	return ChainProvider{
+		&StaticProvider{keyId, applicationKey},
+		&EnvProvider{},
+		&FileProvider{},
+	}
+}
+
+// NewB2 return a B2 using the credentials retrieved from provider.
+func NewB2(provider CredentialsProvider) (*B2, error) {
+	credentials, err := provider.Retrieve()
+	if err != nil {
+		return nil, err
+	}
+	return &B2{
+		KeyId:          credentials.KeyId,
+		ApplicationKey: credentials.ApplicationKey,
+	}, nil
+}
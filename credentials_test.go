@@ -0,0 +1,225 @@
+// Copyright 2018 hryyan. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package b2
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// writeCredentials write a credentials file under a new XDG_CONFIG_HOME and return its path.
+func writeCredentials(t *testing.T, content string) string {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	if err := os.MkdirAll(filepath.Join(dir, "b2"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "b2", "credentials")
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// clearEnv unset the credentials in the environment for the test.
+func clearEnv(t *testing.T) {
+	for _, name := range []string{"B2_APPLICATION_KEY_ID", "B2_ACCOUNT_ID", "B2_APPLICATION_KEY"} {
+		t.Setenv(name, "")
+	}
+}
+
+func skipWithoutShell(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("credential processes are tested with sh")
+	}
+}
+
+func TestDefaultCredentialsPath(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", "/etc/xdg")
+	if path := DefaultCredentialsPath(); path != filepath.Join("/etc/xdg", "b2", "credentials") {
+		t.Fatalf("Wrong path with XDG_CONFIG_HOME %s", path)
+	}
+
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("HOME", "/home/b2")
+	if path := DefaultCredentialsPath(); path != filepath.Join("/home/b2", ".config", "b2", "credentials") {
+		t.Fatalf("Wrong path without XDG_CONFIG_HOME %s", path)
+	}
+}
+
+func TestReadProfiles(t *testing.T) {
+	path := writeCredentials(t, `
+# comment
+; another comment
+[default]
+application_key_id = key1
+application_key = secret=with=equals
+
+[ staging ]
+credential_process = echo {}
+`)
+
+	profiles, err := ReadProfiles(path)
+	if err != nil {
+		t.Fatalf("Read profiles failed: %s", err.Error())
+	}
+	if len(profiles) != 2 {
+		t.Fatalf("Should read 2 profiles, got %v", profiles)
+	}
+	if key := profiles["default"]["application_key"]; key != "secret=with=equals" {
+		t.Fatalf("Value should keep its equal signs, got %q", key)
+	}
+	if command := profiles["staging"]["credential_process"]; command != "echo {}" {
+		t.Fatalf("Wrong credential process %q", command)
+	}
+
+	for _, content := range []string{
+		"application_key_id = key1\n",
+		"[default]\napplication_key_id\n",
+	} {
+		path = writeCredentials(t, content)
+		if _, err = ReadProfiles(path); err == nil || !strings.Contains(err.Error(), ":") {
+			t.Fatalf("Malformed %q should fail with its line, got %v", content, err)
+		}
+	}
+}
+
+func TestFileProvider(t *testing.T) {
+	path := writeCredentials(t, `
+[default]
+application_key_id = key1
+application_key = secret1
+
+[production]
+application_key_id = key2
+application_key = secret2
+
+[incomplete]
+application_key_id = key3
+`)
+
+	credentials, err := (&FileProvider{Path: path}).Retrieve()
+	if err != nil || credentials.KeyId != "key1" || credentials.Source != "profile default" {
+		t.Fatalf("Should read the default profile, got %+v %v", credentials, err)
+	}
+
+	credentials, err = (&FileProvider{Path: path, Profile: "production"}).Retrieve()
+	if err != nil || credentials.KeyId != "key2" || credentials.ApplicationKey != "secret2" {
+		t.Fatalf("Should read the production profile, got %+v %v", credentials, err)
+	}
+
+	if _, err = (&FileProvider{Path: path, Profile: "missing"}).Retrieve(); err == nil || err == ErrNoCredentials {
+		t.Fatalf("A missing named profile should fail, got %v", err)
+	}
+	if _, err = (&FileProvider{Path: path, Profile: "incomplete"}).Retrieve(); err == nil || err == ErrNoCredentials {
+		t.Fatalf("An incomplete profile should fail, got %v", err)
+	}
+	if _, err = (&FileProvider{Path: path + ".missing"}).Retrieve(); err != ErrNoCredentials {
+		t.Fatalf("A missing file should provide no credentials, got %v", err)
+	}
+
+	path = writeCredentials(t, "[other]\napplication_key_id = key1\napplication_key = secret1\n")
+	if _, err = (&FileProvider{Path: path}).Retrieve(); err != ErrNoCredentials {
+		t.Fatalf("A missing default profile should provide no credentials, got %v", err)
+	}
+}
+
+func TestFileProviderCredentialProcess(t *testing.T) {
+	skipWithoutShell(t)
+	path := writeCredentials(t, `
+[staging]
+credential_process = echo '{"applicationKeyId": "key4", "applicationKey": "secret4"}'
+`)
+
+	credentials, err := (&FileProvider{Path: path, Profile: "staging"}).Retrieve()
+	if err != nil || credentials.KeyId != "key4" || credentials.Source != "command" {
+		t.Fatalf("Should run the credential process, got %+v %v", credentials, err)
+	}
+}
+
+func TestCommandProvider(t *testing.T) {
+	skipWithoutShell(t)
+
+	credentials, err := (&CommandProvider{`printf '{"applicationKeyId":"key5","applicationKey":"secret5"}'`}).Retrieve()
+	if err != nil || credentials.KeyId != "key5" || credentials.ApplicationKey != "secret5" {
+		t.Fatalf("Should read the printed credentials, got %+v %v", credentials, err)
+	}
+
+	for _, command := range []string{
+		"echo key5 secret5",
+		`echo '{"applicationKeyId": "key5"}'`,
+		"echo failed >&2; exit 3",
+	} {
+		if _, err = (&CommandProvider{command}).Retrieve(); err == nil || err == ErrNoCredentials {
+			t.Fatalf("Command %q should fail, got %v", command, err)
+		}
+	}
+
+	_, err = (&CommandProvider{"echo failed >&2; exit 3"}).Retrieve()
+	if !strings.Contains(err.Error(), "failed") {
+		t.Fatalf("The error should carry stderr, got %s", err.Error())
+	}
+}
+
+func TestProviderChainPrecedence(t *testing.T) {
+	clearEnv(t)
+	writeCredentials(t, `
+[default]
+application_key_id = fileKey
+application_key = fileSecret
+
+[production]
+application_key_id = productionKey
+application_key = productionSecret
+`)
+
+	retrieve := func(keyId, applicationKey, profile string) string {
+		t.Helper()
+		credentials, err := DefaultProviderChain(keyId, applicationKey, profile).Retrieve()
+		if err != nil {
+			t.Fatalf("Retrieve failed: %s", err.Error())
+		}
+		return credentials.KeyId
+	}
+
+	if keyId := retrieve("", "", ""); keyId != "fileKey" {
+		t.Fatalf("Should fall back to the file, got %s", keyId)
+	}
+
+	t.Setenv("B2_ACCOUNT_ID", "accountKey")
+	t.Setenv("B2_APPLICATION_KEY", "envSecret")
+	if keyId := retrieve("", "", ""); keyId != "accountKey" {
+		t.Fatalf("B2_ACCOUNT_ID should be read for compatibility, got %s", keyId)
+	}
+	t.Setenv("B2_APPLICATION_KEY_ID", "envKey")
+	if keyId := retrieve("", "", ""); keyId != "envKey" {
+		t.Fatalf("B2_APPLICATION_KEY_ID should be preferred, got %s", keyId)
+	}
+
+	if keyId := retrieve("staticKey", "staticSecret", ""); keyId != "staticKey" {
+		t.Fatalf("Explicit values should win, got %s", keyId)
+	}
+	if keyId := retrieve("staticKey", "", ""); keyId != "envKey" {
+		t.Fatalf("Incomplete explicit values should be skipped, got %s", keyId)
+	}
+	if keyId := retrieve("", "", "production"); keyId != "productionKey" {
+		t.Fatalf("A profile should win over the environment, got %s", keyId)
+	}
+
+	if _, err := DefaultProviderChain("", "", "missing").Retrieve(); err == nil {
+		t.Fatal("A missing profile should fail")
+	}
+
+	clearEnv(t)
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	if _, err := DefaultProviderChain("", "", "").Retrieve(); err != ErrNoCredentials {
+		t.Fatalf("Should find no credentials, got %v", err)
+	}
+}
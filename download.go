@@ -7,7 +7,10 @@ package b2
 import (
 	"fmt"
 	"io"
+	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
 )
 
 // GetDownloadAuthorization create a download url and a token.
@@ -18,13 +21,23 @@ import (
 // GetDownloadAuthorization return a DownloadUrlToken pointer and an error.
 func (b *B2) GetDownloadAuthorization(bucketId, fileNamePrefix string,
 	validDurationInSeconds int64) (*DownloadUrlToken, error) {
+	return b.GetDownloadAuthorizationAs(bucketId, fileNamePrefix, validDurationInSeconds, "")
+}
+
+// GetDownloadAuthorizationAs is GetDownloadAuthorization with a Content-Disposition override.
+//
+// Parameter contentDisposition can be empty, otherwise downloads with the token must
+// pass the same value as b2ContentDisposition, see GetAuthorizedFileDownloadURL.
+func (b *B2) GetDownloadAuthorizationAs(bucketId, fileNamePrefix string,
+	validDurationInSeconds int64, contentDisposition string) (*DownloadUrlToken, error) {
 	var (
-		url         = fmt.Sprintf("%s/b2api/v1/b2_get_download_authorization", b.auth.ApiUrl)
+		url         = fmt.Sprintf("%s/b2api/v1/b2_get_download_authorization", b.GetAuth().ApiUrl)
 		requestBody = &struct {
 			BucketId               string `json:"bucketId"`
 			FileNamePrefix         string `json:"fileNamePrefix"`
 			ValidDurationInSeconds int64  `json:"validDurationInSeconds"`
-		}{bucketId, fileNamePrefix, validDurationInSeconds}
+			B2ContentDisposition   string `json:"b2ContentDisposition,omitempty"`
+		}{bucketId, fileNamePrefix, validDurationInSeconds, contentDisposition}
 		responseBody = &DownloadUrlToken{}
 	)
 
@@ -51,46 +64,18 @@ func (b *B2) GetDownloadAuthorization(bucketId, fileNamePrefix string,
 // https://www.backblaze.com/b2/docs/b2_download_file_by_id.html
 //
 // Parameter fileId and filePath are required, if the bucket is private, you should pass needAuth as true.
-// Parameter filePath is the local file path you want to save.
+// Parameter filePath is the local file path you want to save, listener can be nil.
 // DownloadFileById return nil if successed, return error if failed.
 func (b *B2) DownloadFileById(fileId, filePath string, needAuth bool,
-	report func(int64, int64)) error {
+	listener ProgressListener) error {
 	var (
-		url     = fmt.Sprintf("%s/b2api/v1/b2_download_file_by_id", b.auth.DownloadUrl)
+		url     = fmt.Sprintf("%s/b2api/v1/b2_download_file_by_id", b.GetAuth().DownloadUrl)
 		queries = map[string]string{
 			"fileId": fileId,
 		}
 	)
 
-	response, err := b.makeDownloadRequest(url, queries, needAuth)
-	if err != nil {
-		return err
-	}
-
-	switch {
-	case response.StatusCode == 200:
-		f, err := os.Create(filePath)
-		if err != nil {
-			return err
-		}
-		defer f.Close()
-		defer response.Body.Close()
-
-		progressWriter := &ProgressReaderWriter{
-			Writer: f,
-			Total:  response.ContentLength,
-			Report: report,
-		}
-
-		if _, err = io.Copy(progressWriter, response.Body); err != nil {
-			return err
-		}
-		return nil
-	case response.StatusCode == 400 || response.StatusCode == 401:
-		return handleErrorResponse(response)
-	default:
-		return handleUnknownResponse(response)
-	}
+	return b.downloadFile(url, queries, filePath, needAuth, listener)
 }
 
 // DownloadFileByName downlaod file from b2 Cloud Storage using bucketName and fileName.
@@ -98,39 +83,81 @@ func (b *B2) DownloadFileById(fileId, filePath string, needAuth bool,
 // https://www.backblaze.com/b2/docs/b2_download_file_by_name.html
 //
 // Parameter bucketName, fileName and filePath are required, if the bucket is private, you should pass needAuth as true.
-// Parameter filePath is the local file path you want to save.
+// Parameter filePath is the local file path you want to save, listener can be nil.
 // DownloadFileByName return nil if successed, return error if failed.
 func (b *B2) DownloadFileByName(bucketName, fileName, filePath string,
-	needAuth bool, report func(int64, int64)) error {
+	needAuth bool, listener ProgressListener) error {
+	var (
+		url = fmt.Sprintf("%s/file/%s/%s", b.GetAuth().DownloadUrl, bucketName, EncodeFileName(fileName))
+	)
+
+	return b.downloadFile(url, map[string]string{}, filePath, needAuth, listener)
+}
+
+// DownloadFileByNameTo download file like DownloadFileByName but write it to w, such as os.Stdout.
+// DownloadFileByNameTo return nil if successed, return error if failed.
+func (b *B2) DownloadFileByNameTo(bucketName, fileName string, w io.Writer,
+	needAuth bool, listener ProgressListener) error {
+	var (
+		url = fmt.Sprintf("%s/file/%s/%s", b.GetAuth().DownloadUrl, bucketName, EncodeFileName(fileName))
+	)
+
+	return b.download(url, map[string]string{}, map[string]string{}, fileName, needAuth, listener,
+		func(response *http.Response, transfer *Transfer) error {
+			return b.writeResponse(response, w, transfer)
+		})
+}
+
+// DownloadFileRangeById download the bytes from start to end inclusive of a file into w,
+// such as a part of a parallel download.
+//
+// Parameter fileId, start, end and w are required, listener can be nil.
+// DownloadFileRangeById return nil if successed, return error if failed.
+func (b *B2) DownloadFileRangeById(fileId string, start, end int64, w io.Writer,
+	needAuth bool, listener ProgressListener) error {
 	var (
-		url = fmt.Sprintf("%s/file/%s/%s", b.auth.DownloadUrl, bucketName, fileName)
+		url     = fmt.Sprintf("%s/b2api/v1/b2_download_file_by_id", b.GetAuth().DownloadUrl)
+		queries = map[string]string{
+			"fileId": fileId,
+		}
+		headers = map[string]string{
+			"Range": fmt.Sprintf("bytes=%d-%d", start, end),
+		}
 	)
 
-	response, err := b.makeDownloadRequest(url, map[string]string{}, needAuth)
+	return b.download(url, queries, headers, fileId, needAuth, listener,
+		func(response *http.Response, transfer *Transfer) error {
+			if response.StatusCode != 206 && (start != 0 || response.ContentLength != end+1) {
+				return fmt.Errorf("Range %d-%d of %s is not supported", start, end, fileId)
+			}
+			return b.writeResponse(response, w, transfer)
+		})
+}
+
+func (b *B2) downloadFile(url string, queries map[string]string, filePath string,
+	needAuth bool, listener ProgressListener) error {
+	return b.download(url, queries, map[string]string{}, filepath.Base(filePath), needAuth, listener,
+		func(response *http.Response, transfer *Transfer) error {
+			return b.saveResponse(response, filePath, transfer)
+		})
+}
+
+func (b *B2) download(url string, queries, headers map[string]string, name string, needAuth bool,
+	listener ProgressListener, save func(*http.Response, *Transfer) error) error {
+	response, err := b.makeDownloadRequest(url, queries, headers, needAuth)
 	if err != nil {
 		return err
 	}
 
 	switch {
-	case response.StatusCode == 200:
-		f, err := os.Create(filePath)
-		if err != nil {
-			return err
-		}
-		defer f.Close()
+	case response.StatusCode == 200 || response.StatusCode == 206:
 		defer response.Body.Close()
 
-		progressWriter := &ProgressReaderWriter{
-			Writer: f,
-			Total:  response.ContentLength,
-			Report: report,
-		}
-
-		_, err = io.Copy(progressWriter, response.Body)
-		if err != nil {
-			return err
-		}
-		return nil
+		transfer := NewTransfer(name, response.ContentLength, listener)
+		transfer.Start()
+		err := save(response, transfer)
+		transfer.Finish(err)
+		return err
 	case response.StatusCode == 400 || response.StatusCode == 401:
 		return handleErrorResponse(response)
 	default:
@@ -138,6 +165,42 @@ func (b *B2) DownloadFileByName(bucketName, fileName, filePath string,
 	}
 }
 
+func (b *B2) saveResponse(response *http.Response, filePath string, listener ProgressListener) error {
+	f, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return b.writeResponse(response, f, listener)
+}
+
+func (b *B2) writeResponse(response *http.Response, w io.Writer, listener ProgressListener) error {
+	progressWriter := &ProgressReaderWriter{
+		Writer:   w,
+		Total:    response.ContentLength,
+		Listener: listener,
+		Limiter:  b.Limiter,
+	}
+
+	if _, err := io.Copy(progressWriter, response.Body); err != nil {
+		return err
+	}
+	return nil
+}
+
 func (b *B2) GetPublicFileDownloadURL(bucketName, fileName string) string {
-	return fmt.Sprintf("%s/file/%s/%s", b.auth.DownloadUrl, bucketName, fileName)
+	return fmt.Sprintf("%s/file/%s/%s", b.GetAuth().DownloadUrl, bucketName, EncodeFileName(fileName))
+}
+
+// GetAuthorizedFileDownloadURL return a download url of a private file with a token
+// from GetDownloadAuthorizationAs, contentDisposition must be the one of the token.
+func (b *B2) GetAuthorizedFileDownloadURL(bucketName, fileName, authorizationToken,
+	contentDisposition string) string {
+	queries := url.Values{}
+	queries.Set("Authorization", authorizationToken)
+	if contentDisposition != "" {
+		queries.Set("b2ContentDisposition", contentDisposition)
+	}
+	return fmt.Sprintf("%s?%s", b.GetPublicFileDownloadURL(bucketName, fileName), queries.Encode())
 }
@@ -0,0 +1,101 @@
+// Copyright 2018 hryyan. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package b2
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestGetDownloadAuthorizationAs(t *testing.T) {
+	fs := newFakeServer(t)
+	bucket := fs.addBucket("photos")
+
+	client := fs.authedClient(t)
+
+	disposition := `attachment; filename="cat.jpg"`
+	token, err := client.GetDownloadAuthorizationAs(bucket.BucketId, "2018/cat 1.jpg", 3600, disposition)
+	if err != nil {
+		t.Fatalf("Get download authorization failed: %s", err.Error())
+	}
+	if token.FileNamePrefix != "2018/cat 1.jpg" || token.AuthorizationToken == "" {
+		t.Fatalf("Wrong download token %+v", token)
+	}
+
+	got := client.GetAuthorizedFileDownloadURL("photos", "2018/cat 1.jpg", "token", disposition)
+	want := fs.URL + "/file/photos/2018/cat%201.jpg?Authorization=token" +
+		"&b2ContentDisposition=attachment%3B+filename%3D%22cat.jpg%22"
+	if got != want {
+		t.Fatalf("Wrong download url %s, want %s", got, want)
+	}
+
+	if _, err = client.GetDownloadAuthorization(bucket.BucketId, "2018/", 604801); err == nil {
+		t.Fatal("Get download authorization longer than a week should fail")
+	}
+
+	key := fs.addKey([]Capability{SHARE_FILES}, bucket.BucketId, "public/")
+	restricted := fs.authedClient(t, key)
+	if _, err = restricted.GetDownloadAuthorization(bucket.BucketId, "private/", 60); err == nil {
+		t.Fatal("Get download authorization outside the key prefix should fail")
+	}
+	if code := ErrorCode(err); code != "unauthorized" {
+		t.Fatalf("Wrong error code %q, want unauthorized", code)
+	}
+}
+
+func TestDownloadFileByNameTo(t *testing.T) {
+	fs := newFakeServer(t)
+	bucket := fs.addBucket("backup")
+	fs.addContent(bucket.BucketId, "logs/app 1.log", "old")
+	fs.addContent(bucket.BucketId, "logs/app 1.log", "hello world")
+
+	client := fs.authedClient(t)
+
+	var (
+		buf         bytes.Buffer
+		transferred int64
+	)
+	listener := ProgressListenerFunc(func(event *ProgressEvent) {
+		if event.Type == BytesTransferred {
+			transferred += event.Bytes
+		}
+	})
+	if err := client.DownloadFileByNameTo("backup", "logs/app 1.log", &buf, true, listener); err != nil {
+		t.Fatalf("Download failed: %s", err.Error())
+	}
+	if buf.String() != "hello world" || transferred != int64(buf.Len()) {
+		t.Fatalf("Wrong download %q, %d bytes transferred", buf.String(), transferred)
+	}
+
+	err := client.DownloadFileByNameTo("backup", "logs/missing.log", &buf, true, nil)
+	if err == nil {
+		t.Fatal("Download a missing file should fail")
+	}
+	if e, ok := err.(*ErrorResponse); !ok || e.Code != "not_found" || e.Status != 404 {
+		t.Fatalf("Download a missing file should fail with not_found, got %#v", err)
+	}
+}
+
+func TestDownloadFileRangeById(t *testing.T) {
+	fs := newFakeServer(t)
+	bucket := fs.addBucket("backup")
+	file := fs.addContent(bucket.BucketId, "disk.img", "0123456789")
+
+	client := fs.authedClient(t)
+
+	var buf bytes.Buffer
+	for _, r := range [][2]int64{{0, 3}, {4, 7}, {8, 9}} {
+		if err := client.DownloadFileRangeById(file.FileId, r[0], r[1], &buf, true, nil); err != nil {
+			t.Fatalf("Download range %v failed: %s", r, err.Error())
+		}
+	}
+	if buf.String() != "0123456789" {
+		t.Fatalf("Wrong reassembled ranges %q", buf.String())
+	}
+
+	if err := client.DownloadFileRangeById(file.FileId, 20, 29, &buf, true, nil); err == nil {
+		t.Fatal("Download a range beyond the file should fail")
+	}
+}
@@ -10,21 +10,48 @@ import (
 	"net/http"
 )
 
+// ErrorResponse is the error returned by b2, Code is one of the error codes
+// documented for each call, such as "bad_auth_token" or "cap_exceeded".
 type ErrorResponse struct {
 	Code    string `json:"code"`
 	Message string `json:"message"`
 	Status  int64  `json:"status"`
 }
 
+func (e *ErrorResponse) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("%s (http status %d)", e.Code, e.Status)
+	}
+	return e.Message
+}
+
+// ErrorCode return the b2 error code of err or the error it wraps, or "" if it is not returned by b2.
+func ErrorCode(err error) string {
+	var e *ErrorResponse
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return ""
+}
+
 func handleErrorResponse(response *http.Response) error {
-	var errorResponse ErrorResponse
-	if err := unmarshalResponseBody(response, &errorResponse); err != nil {
+	errorResponse := &ErrorResponse{}
+	if err := unmarshalResponseBody(response, errorResponse); err != nil {
 		return err
 	}
-	return errors.New(errorResponse.Message)
+	if errorResponse.Status == 0 {
+		errorResponse.Status = int64(response.StatusCode)
+	}
+	return errorResponse
 }
 
+// handleUnknownResponse return the error of an unexpected http status,
+// with the b2 error code if the body carries one.
 func handleUnknownResponse(response *http.Response) error {
-	var errStr = fmt.Sprintf("Unknown http status %d\n", response.StatusCode)
-	return errors.New(errStr)
+	errorResponse := &ErrorResponse{}
+	if err := unmarshalResponseBody(response, errorResponse); err != nil || errorResponse.Code == "" {
+		errorResponse = &ErrorResponse{Message: fmt.Sprintf("Unknown http status %d", response.StatusCode)}
+	}
+	errorResponse.Status = int64(response.StatusCode)
+	return errorResponse
 }
@@ -0,0 +1,543 @@
+// Copyright 2018 hryyan. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package b2
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeServer is an in-memory b2 api server enforcing account ids
+// and the bucket and prefix restrictions of application keys.
+type fakeServer struct {
+	*httptest.Server
+
+	accountId string
+	masterKey string
+
+	mu      sync.Mutex
+	nextId  int
+	keys    map[string]*ApplicationKey
+	tokens  map[string]*ApplicationKey
+	buckets map[string]*Bucket
+	files   map[string][]*File
+	parts   map[string][]*Part
+	content map[string]string
+	// failures is the number of the next requests of an api failing with 503.
+	failures map[string]int
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	fs := &fakeServer{
+		accountId: "account0001",
+		masterKey: "masterSecret",
+		keys:      map[string]*ApplicationKey{},
+		tokens:    map[string]*ApplicationKey{},
+		buckets:   map[string]*Bucket{},
+		files:     map[string][]*File{},
+		parts:     map[string][]*Part{},
+		content:   map[string]string{},
+		failures:  map[string]int{},
+	}
+	fs.keys[fs.accountId] = &ApplicationKey{
+		ApplicationKeyId: fs.accountId,
+		ApplicationKey:   fs.masterKey,
+		KeyName:          "master",
+		Capabilities:     AllCapabilities,
+	}
+	fs.Server = httptest.NewServer(http.HandlerFunc(fs.serve))
+	t.Cleanup(fs.Close)
+	return fs
+}
+
+// client return an unauthorized client of the server.
+func (fs *fakeServer) client(keyId, applicationKey string) *B2 {
+	return &B2{
+		KeyId:          keyId,
+		ApplicationKey: applicationKey,
+		AuthUrl:        fs.URL + "/b2api/v1/b2_authorize_account",
+	}
+}
+
+// authedClient return a client of the server authorized with the master key,
+// or with key if it is given.
+func (fs *fakeServer) authedClient(t *testing.T, key ...*ApplicationKey) *B2 {
+	t.Helper()
+	client := fs.client(fs.accountId, fs.masterKey)
+	if len(key) > 0 {
+		client = fs.client(key[0].ApplicationKeyId, key[0].ApplicationKey)
+	}
+	if err := client.Auth(); err != nil {
+		t.Fatalf("Auth failed: %s", err.Error())
+	}
+	return client
+}
+
+func (fs *fakeServer) id(prefix string) string {
+	fs.nextId++
+	return fmt.Sprintf("%s%04d", prefix, fs.nextId)
+}
+
+func (fs *fakeServer) addBucket(name string) *Bucket {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	bucket := &Bucket{BucketId: fs.id("bucket"), BucketName: name, BucketType: PRIVATE, Revision: 1}
+	fs.buckets[bucket.BucketId] = bucket
+	return bucket
+}
+
+func (fs *fakeServer) addFile(bucketId, name string) *File {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	file := &File{
+		FileId:          fs.id("file"),
+		FileName:        name,
+		Action:          "upload",
+		ContentType:     "text/plain",
+		UploadTimestamp: int64(fs.nextId),
+	}
+	fs.files[bucketId] = append(fs.files[bucketId], file)
+	return file
+}
+
+func (fs *fakeServer) addContent(bucketId, name, content string) *File {
+	file := fs.addFile(bucketId, name)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	file.ContentLength = int64(len(content))
+	fs.content[file.FileId] = content
+	return file
+}
+
+func (fs *fakeServer) addPart(fileId string, partNumber, contentLength int64) *Part {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	part := &Part{
+		FileId:          fileId,
+		PartNumber:      partNumber,
+		ContentLength:   contentLength,
+		ContentSha1:     fmt.Sprintf("sha1-%d", partNumber),
+		UploadTimestamp: int64(fs.nextId),
+	}
+	fs.parts[fileId] = append(fs.parts[fileId], part)
+	return part
+}
+
+func (fs *fakeServer) addKey(capabilities []Capability, bucketId, namePrefix string) *ApplicationKey {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	key := &ApplicationKey{
+		ApplicationKeyId: fs.id("key"),
+		ApplicationKey:   fs.id("secret"),
+		KeyName:          "restricted",
+		Capabilities:     capabilities,
+		BucketId:         bucketId,
+		NamePrefix:       namePrefix,
+	}
+	fs.keys[key.ApplicationKeyId] = key
+	return key
+}
+
+// failNext make the next n requests of the api name fail with 503.
+func (fs *fakeServer) failNext(name string, n int) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.failures[name] = n
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, &ErrorResponse{Code: code, Message: message, Status: int64(status)})
+}
+
+func hasCapability(key *ApplicationKey, capability Capability) bool {
+	for _, c := range key.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+func (fs *fakeServer) serve(w http.ResponseWriter, r *http.Request) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	name := path.Base(r.URL.Path)
+	if fs.failures[name] > 0 {
+		fs.failures[name]--
+		writeError(w, 503, "service_unavailable", "Service is busy, try again")
+		return
+	}
+	if name == "b2_authorize_account" {
+		fs.authorize(w, r)
+		return
+	}
+
+	key, ok := fs.tokens[r.Header.Get("Authorization")]
+	if !ok {
+		writeError(w, 401, "bad_auth_token", "Invalid authorization token")
+		return
+	}
+
+	if strings.HasPrefix(r.URL.Path, "/file/") {
+		fs.download(w, r, key)
+		return
+	}
+	if name == "b2_download_file_by_id" {
+		fs.downloadById(w, r, key)
+		return
+	}
+
+	var body struct {
+		AccountId        string            `json:"accountId"`
+		BucketId         string            `json:"bucketId"`
+		BucketName       string            `json:"bucketName"`
+		BucketType       string            `json:"bucketType"`
+		Prefix           string            `json:"prefix"`
+		Capabilities     []Capability      `json:"capabilities"`
+		KeyName          string            `json:"keyName"`
+		NamePrefix       string            `json:"namePrefix"`
+		ApplicationKeyId string            `json:"applicationKeyId"`
+		StartFileName    string            `json:"startFileName"`
+		StartFileId      string            `json:"startFileId"`
+		MaxFileCount     int               `json:"maxFileCount"`
+		SourceFileId     string            `json:"sourceFileId"`
+		DestBucketId     string            `json:"destinationBucketId"`
+		FileName         string            `json:"fileName"`
+		BucketInfo       map[string]string `json:"bucketInfo"`
+		CorsRules        []CorsRule        `json:"corsRules"`
+		IfRevisionIs     int64             `json:"ifRevisionIs"`
+		FileNamePrefix   string            `json:"fileNamePrefix"`
+		ValidDuration    int64             `json:"validDurationInSeconds"`
+		Disposition      string            `json:"b2ContentDisposition"`
+		FileId           string            `json:"fileId"`
+		StartPartNumber  int64             `json:"startPartNumber"`
+		MaxPartCount     int               `json:"maxPartCount"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, 400, "bad_request", err.Error())
+		return
+	}
+
+	switch name {
+	case "b2_list_buckets", "b2_create_bucket", "b2_delete_bucket", "b2_update_bucket",
+		"b2_list_keys", "b2_create_key":
+		if body.AccountId != fs.accountId {
+			writeError(w, 401, "unauthorized", "Account id does not match the authorized account")
+			return
+		}
+	}
+
+	switch name {
+	case "b2_list_buckets":
+		if !hasCapability(key, LIST_BUCKETS) {
+			writeError(w, 401, "unauthorized", "Key does not have listBuckets")
+			return
+		}
+		buckets := []*Bucket{}
+		for _, bucket := range fs.buckets {
+			if (body.BucketId != "" && body.BucketId != bucket.BucketId) ||
+				(body.BucketName != "" && body.BucketName != bucket.BucketName) {
+				continue
+			}
+			if key.BucketId != "" && key.BucketId != bucket.BucketId {
+				writeError(w, 401, "unauthorized", "Key is restricted to a bucket")
+				return
+			}
+			buckets = append(buckets, bucket)
+		}
+		writeJSON(w, 200, map[string]interface{}{"buckets": buckets})
+	case "b2_create_bucket":
+		if !hasCapability(key, WRITE_BUCKETS) || key.BucketId != "" {
+			writeError(w, 401, "unauthorized", "Key can not create buckets")
+			return
+		}
+		bucket := &Bucket{BucketId: fs.id("bucket"), BucketName: body.BucketName, BucketType: body.BucketType, Revision: 1}
+		fs.buckets[bucket.BucketId] = bucket
+		writeJSON(w, 200, bucket)
+	case "b2_update_bucket":
+		bucket, ok := fs.buckets[body.BucketId]
+		if !hasCapability(key, WRITE_BUCKETS) || !ok {
+			writeError(w, 401, "unauthorized", "Key can not update the bucket")
+			return
+		}
+		if body.IfRevisionIs != 0 && body.IfRevisionIs != bucket.Revision {
+			writeError(w, 409, "conflict", "Bucket revision does not match")
+			return
+		}
+		if body.BucketType != "" {
+			bucket.BucketType = body.BucketType
+		}
+		if body.BucketInfo != nil {
+			bucket.BucketInfo = body.BucketInfo
+		}
+		if body.CorsRules != nil {
+			bucket.CorsRules = body.CorsRules
+		}
+		bucket.Revision++
+		writeJSON(w, 200, bucket)
+	case "b2_list_file_names", "b2_list_file_versions":
+		if !hasCapability(key, LIST_FILES) ||
+			(key.BucketId != "" && key.BucketId != body.BucketId) ||
+			!strings.HasPrefix(body.Prefix, key.NamePrefix) {
+			writeError(w, 401, "unauthorized", "Key is restricted to another bucket or prefix")
+			return
+		}
+		fs.listFiles(w, name == "b2_list_file_versions", body.BucketId, body.Prefix,
+			body.StartFileName, body.StartFileId, body.MaxFileCount)
+	case "b2_copy_file":
+		source, sourceBucketId := fs.findFile(body.SourceFileId)
+		if source == nil {
+			writeError(w, 400, "bad_request", "Source file not found")
+			return
+		}
+		bucketId := body.DestBucketId
+		if bucketId == "" {
+			bucketId = sourceBucketId
+		}
+		if !hasCapability(key, WRITE_FILES) || (key.BucketId != "" && key.BucketId != bucketId) {
+			writeError(w, 401, "unauthorized", "Key can not write the destination bucket")
+			return
+		}
+		copied := *source
+		copied.FileId = fs.id("file")
+		copied.FileName = body.FileName
+		copied.UploadTimestamp = int64(fs.nextId)
+		fs.files[bucketId] = append(fs.files[bucketId], &copied)
+		writeJSON(w, 200, &copied)
+	case "b2_list_parts":
+		if !hasCapability(key, WRITE_FILES) {
+			writeError(w, 401, "unauthorized", "Key does not have writeFiles")
+			return
+		}
+		parts := fs.parts[body.FileId]
+		sort.Slice(parts, func(i, j int) bool { return parts[i].PartNumber < parts[j].PartNumber })
+		page := &Parts{Parts: []*Part{}}
+		for _, part := range parts {
+			if part.PartNumber < body.StartPartNumber {
+				continue
+			}
+			if body.MaxPartCount > 0 && len(page.Parts) == body.MaxPartCount {
+				page.NextPartNumber = part.PartNumber
+				break
+			}
+			page.Parts = append(page.Parts, part)
+		}
+		writeJSON(w, 200, page)
+	case "b2_get_download_authorization":
+		if !hasCapability(key, SHARE_FILES) ||
+			(key.BucketId != "" && key.BucketId != body.BucketId) ||
+			!strings.HasPrefix(body.FileNamePrefix, key.NamePrefix) {
+			writeError(w, 401, "unauthorized", "Key can not share the files")
+			return
+		}
+		if body.ValidDuration < 1 || body.ValidDuration > 604800 {
+			writeError(w, 400, "bad_request", "validDurationInSeconds out of range")
+			return
+		}
+		writeJSON(w, 200, map[string]string{
+			"bucketId":           body.BucketId,
+			"fileNamePrefix":     body.FileNamePrefix,
+			"authorizationToken": fmt.Sprintf("download-%s-%s", body.FileNamePrefix, body.Disposition),
+		})
+	case "b2_create_key":
+		if !hasCapability(key, WRITE_KEYS) {
+			writeError(w, 401, "unauthorized", "Key does not have writeKeys")
+			return
+		}
+		created := &ApplicationKey{
+			ApplicationKeyId: fs.id("key"),
+			ApplicationKey:   fs.id("secret"),
+			KeyName:          body.KeyName,
+			Capabilities:     body.Capabilities,
+			BucketId:         body.BucketId,
+			NamePrefix:       body.NamePrefix,
+		}
+		fs.keys[created.ApplicationKeyId] = created
+		writeJSON(w, 200, created)
+	case "b2_list_keys":
+		if !hasCapability(key, LIST_KEYS) {
+			writeError(w, 401, "unauthorized", "Key does not have listKeys")
+			return
+		}
+		keys := []*ApplicationKey{}
+		for _, k := range fs.keys {
+			if k.ApplicationKeyId == fs.accountId {
+				continue
+			}
+			listed := *k
+			listed.ApplicationKey = ""
+			keys = append(keys, &listed)
+		}
+		writeJSON(w, 200, &ApplicationKeys{Keys: keys})
+	case "b2_delete_key":
+		deleted, ok := fs.keys[body.ApplicationKeyId]
+		if !hasCapability(key, DELETE_KEYS) || !ok {
+			writeError(w, 400, "bad_request", "Key not found")
+			return
+		}
+		delete(fs.keys, body.ApplicationKeyId)
+		writeJSON(w, 200, deleted)
+	default:
+		writeError(w, 400, "bad_request", "Unsupported api "+name)
+	}
+}
+
+func (fs *fakeServer) authorize(w http.ResponseWriter, r *http.Request) {
+	keyId, applicationKey, ok := r.BasicAuth()
+	key, found := fs.keys[keyId]
+	if !ok || !found || key.ApplicationKey != applicationKey {
+		writeError(w, 401, "unauthorized", "Invalid key id or application key")
+		return
+	}
+
+	token := fs.id("token")
+	fs.tokens[token] = key
+
+	allowed := Allowed{Capabilities: key.Capabilities, BucketId: key.BucketId, NamePrefix: key.NamePrefix}
+	if bucket, ok := fs.buckets[key.BucketId]; ok {
+		allowed.BucketName = bucket.BucketName
+	}
+
+	writeJSON(w, 200, &AuthResponse{
+		AccountId:               fs.accountId,
+		AuthorizationToken:      token,
+		ApiUrl:                  fs.URL,
+		DownloadUrl:             fs.URL,
+		RecommendedPartSize:     100000000,
+		AbsoluteMinimumPartSize: 5000000,
+		Allowed:                 allowed,
+	})
+}
+
+func (fs *fakeServer) findFile(fileId string) (*File, string) {
+	for bucketId, files := range fs.files {
+		for _, file := range files {
+			if file.FileId == fileId {
+				return file, bucketId
+			}
+		}
+	}
+	return nil, ""
+}
+
+// listFiles write a page of files sorted by name, then newest first.
+// Only the latest upload of each name is listed if versions is false.
+func (fs *fakeServer) listFiles(w http.ResponseWriter, versions bool, bucketId, prefix,
+	startFileName, startFileId string, maxFileCount int) {
+	all := append([]*File{}, fs.files[bucketId]...)
+	sort.SliceStable(all, func(i, j int) bool {
+		if all[i].FileName != all[j].FileName {
+			return all[i].FileName < all[j].FileName
+		}
+		return all[i].UploadTimestamp > all[j].UploadTimestamp
+	})
+	if maxFileCount <= 0 {
+		maxFileCount = 100
+	}
+
+	var (
+		files   = []*File{}
+		started = startFileId == ""
+	)
+	for i, file := range all {
+		if !strings.HasPrefix(file.FileName, prefix) || file.FileName < startFileName {
+			continue
+		}
+		if !started {
+			started = file.FileId == startFileId
+			if !started {
+				continue
+			}
+		}
+		if !versions && (file.Action != "upload" || (i > 0 && all[i-1].FileName == file.FileName)) {
+			continue
+		}
+
+		if len(files) == maxFileCount {
+			if versions {
+				writeJSON(w, 200, &FileVersions{Files: files, NextFileName: file.FileName, NextFileId: file.FileId})
+			} else {
+				writeJSON(w, 200, &FileNames{Files: files, NextFileName: file.FileName})
+			}
+			return
+		}
+		files = append(files, file)
+	}
+
+	if versions {
+		writeJSON(w, 200, &FileVersions{Files: files})
+	} else {
+		writeJSON(w, 200, &FileNames{Files: files})
+	}
+}
+
+// download serve the latest version of /file/bucketName/fileName.
+func (fs *fakeServer) download(w http.ResponseWriter, r *http.Request, key *ApplicationKey) {
+	names := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/file/"), "/", 2)
+	if len(names) != 2 {
+		writeError(w, 400, "bad_request", "Bad file url")
+		return
+	}
+
+	for bucketId, bucket := range fs.buckets {
+		if bucket.BucketName != names[0] {
+			continue
+		}
+		if !hasCapability(key, READ_FILES) || (key.BucketId != "" && key.BucketId != bucketId) ||
+			!strings.HasPrefix(names[1], key.NamePrefix) {
+			writeError(w, 401, "unauthorized", "Key can not read the file")
+			return
+		}
+
+		var latest *File
+		for _, file := range fs.files[bucketId] {
+			if file.FileName == names[1] && (latest == nil || file.UploadTimestamp > latest.UploadTimestamp) {
+				latest = file
+			}
+		}
+		if latest == nil || latest.Action != "upload" {
+			break
+		}
+		fs.serveContent(w, r, latest)
+		return
+	}
+	writeError(w, 404, "not_found", "File not found")
+}
+
+// downloadById serve the version ?fileId= of b2_download_file_by_id.
+func (fs *fakeServer) downloadById(w http.ResponseWriter, r *http.Request, key *ApplicationKey) {
+	file, bucketId := fs.findFile(r.URL.Query().Get("fileId"))
+	if file == nil || file.Action != "upload" {
+		writeError(w, 404, "not_found", "File not found")
+		return
+	}
+	if !hasCapability(key, READ_FILES) || (key.BucketId != "" && key.BucketId != bucketId) ||
+		!strings.HasPrefix(file.FileName, key.NamePrefix) {
+		writeError(w, 401, "unauthorized", "Key can not read the file")
+		return
+	}
+	fs.serveContent(w, r, file)
+}
+
+// serveContent write the content of file, honoring Range headers.
+func (fs *fakeServer) serveContent(w http.ResponseWriter, r *http.Request, file *File) {
+	w.Header().Set("Content-Type", file.ContentType)
+	http.ServeContent(w, r, file.FileName, time.Time{}, strings.NewReader(fs.content[file.FileId]))
+}
@@ -6,9 +6,35 @@ package b2
 
 import (
 	"fmt"
-	"log"
+	"strconv"
+	"time"
 )
 
+// Sha1 return the SHA1 of the file content, large files keep it in the
+// "large_file_sha1" file info. Sha1 return "" if it is unknown.
+func (f *File) Sha1() string {
+	if f.ContentSha1 != "" && f.ContentSha1 != "none" {
+		return f.ContentSha1
+	}
+	if sha1, ok := f.FileInfo["large_file_sha1"].(string); ok {
+		return sha1
+	}
+	return ""
+}
+
+// SrcLastModified return the modification time in the "src_last_modified_millis" file info.
+func (f *File) SrcLastModified() (time.Time, bool) {
+	millis, ok := f.FileInfo["src_last_modified_millis"].(string)
+	if !ok {
+		return time.Time{}, false
+	}
+	n, err := strconv.ParseInt(millis, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, n*int64(time.Millisecond)), true
+}
+
 // ListFileNames list files names.
 // See "b2_list_file_names" for an introduction:
 // https://www.backblaze.com/b2/docs/b2_list_file_names.html
@@ -17,8 +43,20 @@ import (
 // ListFileNames return a File array and an error.
 func (b *B2) ListFileNames(bucketId, startFileName, prefix, delimiter string,
 	maxFileCount int64) ([]*File, error) {
+	page, err := b.ListFileNamesPage(bucketId, startFileName, prefix, delimiter, maxFileCount)
+	if err != nil {
+		return nil, err
+	}
+	return page.Files, nil
+}
+
+// ListFileNamesPage list a page of file names like ListFileNames,
+// pass FileNames.NextFileName as startFileName to get the next page.
+// ListFileNamesPage return a FileNames pointer and an error.
+func (b *B2) ListFileNamesPage(bucketId, startFileName, prefix, delimiter string,
+	maxFileCount int64) (*FileNames, error) {
 	var (
-		url         = fmt.Sprintf("%s/b2api/v1/b2_list_file_names", b.auth.ApiUrl)
+		url         = fmt.Sprintf("%s/b2api/v1/b2_list_file_names", b.GetAuth().ApiUrl)
 		requestBody = &struct {
 			BucketId      string `json:"bucketId"`
 			StartFileName string `json:"startFileName,omitempty"`
@@ -26,10 +64,7 @@ func (b *B2) ListFileNames(bucketId, startFileName, prefix, delimiter string,
 			Delimiter     string `json:"delimiter,omitempty"`
 			MaxFileCount  int64  `json:"maxFileCount,omitempty"`
 		}{bucketId, startFileName, prefix, delimiter, maxFileCount}
-		responseBody = &struct {
-			Files        []*File `json:"files"`
-			NextFileName string  `json:"nextFileName"`
-		}{}
+		responseBody = &FileNames{}
 	)
 
 	response, err := b.makeAuthedRequest(url, requestBody)
@@ -42,7 +77,7 @@ func (b *B2) ListFileNames(bucketId, startFileName, prefix, delimiter string,
 		if err = unmarshalResponseBody(response, responseBody); err != nil {
 			return nil, err
 		}
-		return responseBody.Files, nil
+		return responseBody, nil
 	case response.StatusCode == 400 || response.StatusCode == 401:
 		return nil, handleErrorResponse(response)
 	default:
@@ -58,21 +93,29 @@ func (b *B2) ListFileNames(bucketId, startFileName, prefix, delimiter string,
 // ListFileVersions return a File array and an error.
 func (b *B2) ListFileVersions(bucketId, startFileName, startFileId, prefix, delimiter string,
 	maxFileCount int64) ([]*File, error) {
+	page, err := b.ListFileVersionsPage(bucketId, startFileName, startFileId, prefix, delimiter, maxFileCount)
+	if err != nil {
+		return nil, err
+	}
+	return page.Files, nil
+}
+
+// ListFileVersionsPage list a page of file versions like ListFileVersions, pass
+// FileVersions.NextFileName and NextFileId as startFileName and startFileId to get the next page.
+// ListFileVersionsPage return a FileVersions pointer and an error.
+func (b *B2) ListFileVersionsPage(bucketId, startFileName, startFileId, prefix, delimiter string,
+	maxFileCount int64) (*FileVersions, error) {
 	var (
-		url         = fmt.Sprintf("%s/b2api/v1/b2_list_file_versions", b.auth.ApiUrl)
+		url         = fmt.Sprintf("%s/b2api/v1/b2_list_file_versions", b.GetAuth().ApiUrl)
 		requestBody = &struct {
 			BucketId      string `json:"bucketId"`
 			StartFileName string `json:"startFileName,omitempty"`
-			StartFileId   string `json:"startField,omitempty"`
+			StartFileId   string `json:"startFileId,omitempty"`
 			Prefix        string `json:"prefix,omitempty"`
 			Delimiter     string `json:"delimiter,omitempty"`
 			MaxFileCount  int64  `json:"maxFileCount,omitempty"`
 		}{bucketId, startFileName, startFileId, prefix, delimiter, maxFileCount}
-		responseBody = &struct {
-			Files        []*File `json:"files"`
-			NextFileName string  `json:"nextFileName"`
-			NextField    string  `json:"nextField"`
-		}{}
+		responseBody = &FileVersions{}
 	)
 
 	response, err := b.makeAuthedRequest(url, requestBody)
@@ -80,14 +123,12 @@ func (b *B2) ListFileVersions(bucketId, startFileName, startFileId, prefix, deli
 		return nil, err
 	}
 
-	log.Println(url)
-
 	switch {
 	case response.StatusCode == 200:
 		if err = unmarshalResponseBody(response, responseBody); err != nil {
 			return nil, err
 		}
-		return responseBody.Files, nil
+		return responseBody, nil
 	case response.StatusCode == 400 || response.StatusCode == 401:
 		return nil, handleErrorResponse(response)
 	default:
@@ -103,7 +144,7 @@ func (b *B2) ListFileVersions(bucketId, startFileName, startFileId, prefix, deli
 // GetFileInfo return a File pointer and an error.
 func (b *B2) GetFileInfo(fileId string) (*File, error) {
 	var (
-		url         = fmt.Sprintf("%s/b2api/v1/b2_get_file_info", b.auth.ApiUrl)
+		url         = fmt.Sprintf("%s/b2api/v1/b2_get_file_info", b.GetAuth().ApiUrl)
 		requestBody = &struct {
 			FileId string `json:"fileId"`
 		}{fileId}
@@ -136,7 +177,7 @@ func (b *B2) GetFileInfo(fileId string) (*File, error) {
 // HideFile return nil if successed, return error if failed.
 func (b *B2) HideFile(bucketId, fileName string) error {
 	var (
-		url         = fmt.Sprintf("%s/b2api/v1/b2_hide_file", b.auth.ApiUrl)
+		url         = fmt.Sprintf("%s/b2api/v1/b2_hide_file", b.GetAuth().ApiUrl)
 		requestBody = &struct {
 			BucketId string `json:"bucketId"`
 			FileName string `json:"fileName"`
@@ -166,7 +207,7 @@ func (b *B2) HideFile(bucketId, fileName string) error {
 // DeleteFileVersion return nil if successed, return error if failed.
 func (b *B2) DeleteFileVersion(fileName, fileId string) error {
 	var (
-		url         = fmt.Sprintf("%s/b2api/v1/b2_delete_file_version", b.auth.ApiUrl)
+		url         = fmt.Sprintf("%s/b2api/v1/b2_delete_file_version", b.GetAuth().ApiUrl)
 		requestBody = &struct {
 			FileName string `json:"fileName"`
 			FileId   string `json:"fileId"`
@@ -187,3 +228,40 @@ func (b *B2) DeleteFileVersion(fileName, fileId string) error {
 		return handleUnknownResponse(response)
 	}
 }
+
+// CopyFile copy a file version on the server side, the content type and file info are kept.
+// See "b2_copy_file" for an introduction:
+// https://www.backblaze.com/b2/docs/b2_copy_file.html
+//
+// Parameter sourceFileId and fileName are required, the file is copied
+// to the source bucket if destinationBucketId is empty.
+// CopyFile return a File pointer and an error.
+func (b *B2) CopyFile(sourceFileId, destinationBucketId, fileName string) (*File, error) {
+	var (
+		url         = fmt.Sprintf("%s/b2api/v1/b2_copy_file", b.GetAuth().ApiUrl)
+		requestBody = &struct {
+			SourceFileId        string `json:"sourceFileId"`
+			DestinationBucketId string `json:"destinationBucketId,omitempty"`
+			FileName            string `json:"fileName"`
+			MetadataDirective   string `json:"metadataDirective"`
+		}{sourceFileId, destinationBucketId, fileName, "COPY"}
+		responseBody = &File{}
+	)
+
+	response, err := b.makeAuthedRequest(url, requestBody)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case response.StatusCode == 200:
+		if err = unmarshalResponseBody(response, responseBody); err != nil {
+			return nil, err
+		}
+		return responseBody, nil
+	case response.StatusCode == 400 || response.StatusCode == 401:
+		return nil, handleErrorResponse(response)
+	default:
+		return nil, handleUnknownResponse(response)
+	}
+}
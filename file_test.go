@@ -0,0 +1,120 @@
+// Copyright 2018 hryyan. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package b2
+
+import (
+	"testing"
+	"time"
+)
+
+func TestListFileNamesPage(t *testing.T) {
+	fs := newFakeServer(t)
+	bucket := fs.addBucket("photos")
+	for _, name := range []string{"a.jpg", "b.jpg", "c.jpg", "d.jpg", "e.jpg"} {
+		fs.addFile(bucket.BucketId, name)
+	}
+	fs.addFile(bucket.BucketId, "c.jpg")
+
+	client := fs.authedClient(t)
+
+	var (
+		names         []string
+		startFileName = ""
+	)
+	for {
+		page, err := client.ListFileNamesPage(bucket.BucketId, startFileName, "", "", 2)
+		if err != nil {
+			t.Fatalf("List file names failed: %s", err.Error())
+		}
+		for _, file := range page.Files {
+			names = append(names, file.FileName)
+		}
+		if page.NextFileName == "" {
+			break
+		}
+		startFileName = page.NextFileName
+	}
+
+	if len(names) != 5 || names[0] != "a.jpg" || names[4] != "e.jpg" {
+		t.Fatalf("Should list 5 names in order, got %v", names)
+	}
+}
+
+func TestListFileVersionsPage(t *testing.T) {
+	fs := newFakeServer(t)
+	bucket := fs.addBucket("photos")
+	for i := 0; i < 3; i++ {
+		fs.addFile(bucket.BucketId, "a.jpg")
+		fs.addFile(bucket.BucketId, "b.jpg")
+	}
+
+	client := fs.authedClient(t)
+
+	var (
+		count         = 0
+		startFileName = ""
+		startFileId   = ""
+	)
+	for {
+		page, err := client.ListFileVersionsPage(bucket.BucketId, startFileName, startFileId, "", "", 4)
+		if err != nil {
+			t.Fatalf("List file versions failed: %s", err.Error())
+		}
+		count += len(page.Files)
+		if page.NextFileName == "" {
+			break
+		}
+		startFileName, startFileId = page.NextFileName, page.NextFileId
+	}
+
+	if count != 6 {
+		t.Fatalf("Should list 6 versions, got %d", count)
+	}
+}
+
+func TestFileSha1AndModified(t *testing.T) {
+	small := &File{ContentSha1: "abc"}
+	large := &File{ContentSha1: "none", FileInfo: FileInfo{
+		"large_file_sha1":          "def",
+		"src_last_modified_millis": "1500000000123",
+	}}
+
+	if small.Sha1() != "abc" || large.Sha1() != "def" {
+		t.Fatalf("Wrong sha1 %s, %s", small.Sha1(), large.Sha1())
+	}
+
+	if _, ok := small.SrcLastModified(); ok {
+		t.Fatal("Small file should not have a modification time")
+	}
+	modified, ok := large.SrcLastModified()
+	if !ok || !modified.Equal(time.Unix(1500000000, 123000000)) {
+		t.Fatalf("Wrong modification time %s", modified)
+	}
+}
+
+func TestCopyFile(t *testing.T) {
+	fs := newFakeServer(t)
+	photos := fs.addBucket("photos")
+	backups := fs.addBucket("backups")
+	source := fs.addFile(photos.BucketId, "a.jpg")
+
+	client := fs.authedClient(t)
+
+	copied, err := client.CopyFile(source.FileId, backups.BucketId, "2018/a.jpg")
+	if err != nil {
+		t.Fatalf("Copy file failed: %s", err.Error())
+	}
+	if copied.FileName != "2018/a.jpg" || copied.FileId == source.FileId {
+		t.Fatalf("Wrong copy %+v", copied)
+	}
+
+	files, err := client.ListFileNames(backups.BucketId, "", "", "", 100)
+	if err != nil {
+		t.Fatalf("List file names failed: %s", err.Error())
+	}
+	if len(files) != 1 || files[0].FileName != "2018/a.jpg" {
+		t.Fatalf("Should see the copy in backups, return %d files", len(files))
+	}
+}
@@ -13,18 +13,29 @@ import (
 // https://www.backblaze.com/b2/docs/b2_create_key.html
 //
 // Parameter capabilities, keyName are required.
+// The capabilities are validated by KeySpec.Validate before sending the request.
 // CreateKey return an ApplicationKey pointer and an error.
-func (b *B2) CreateKey(capabilities []string, keyName string, validDurationInSeconds int64, bucketId string, namePrefix string) (*ApplicationKey, error) {
+func (b *B2) CreateKey(capabilities []Capability, keyName string, validDurationInSeconds int64, bucketId string, namePrefix string) (*ApplicationKey, error) {
+	return b.CreateKeyWithSpec(keyName, validDurationInSeconds, &KeySpec{capabilities, bucketId, namePrefix})
+}
+
+// CreateKeyWithSpec creates a new application key scoped by spec,
+// such as ReadOnly(bucketId, "logs/").
+func (b *B2) CreateKeyWithSpec(keyName string, validDurationInSeconds int64, spec *KeySpec) (*ApplicationKey, error) {
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+
 	var (
-		url         = fmt.Sprintf("%s/b2api/v1/b2_create_key", b.auth.ApiUrl)
+		url         = fmt.Sprintf("%s/b2api/v1/b2_create_key", b.GetAuth().ApiUrl)
 		requestBody = &struct {
-			AccountId              string   `json:"accountId"`
-			Capabilities           []string `json:"capabilities"`
-			KeyName                string   `json:"keyName"`
-			ValidDurationInSeconds int64    `json:"validDurationInSeconds,omitempty"`
-			BucketId               string   `json:"bucketId,omitempty"`
-			NamePrefix             string   `json:"namePrefix,omitempty"`
-		}{b.auth.AccountId, capabilities, keyName, validDurationInSeconds, bucketId, namePrefix}
+			AccountId              string       `json:"accountId"`
+			Capabilities           []Capability `json:"capabilities"`
+			KeyName                string       `json:"keyName"`
+			ValidDurationInSeconds int64        `json:"validDurationInSeconds,omitempty"`
+			BucketId               string       `json:"bucketId,omitempty"`
+			NamePrefix             string       `json:"namePrefix,omitempty"`
+		}{b.GetAuth().AccountId, spec.Capabilities, keyName, validDurationInSeconds, spec.BucketId, spec.NamePrefix}
 		responseBody = &ApplicationKey{}
 	)
 
@@ -54,7 +65,7 @@ func (b *B2) CreateKey(capabilities []string, keyName string, validDurationInSec
 // DeleteKey return nil if delete successd or error if something error happened.
 func (b *B2) DeleteKey(key *ApplicationKey) error {
 	var (
-		url         = fmt.Sprintf("%s/b2api/v1/b2_delete_key", b.auth.ApiUrl)
+		url         = fmt.Sprintf("%s/b2api/v1/b2_delete_key", b.GetAuth().ApiUrl)
 		requestBody = &struct {
 			Application string `json:"applicationKeyId"`
 		}{key.ApplicationKeyId}
@@ -86,12 +97,12 @@ func (b *B2) DeleteKey(key *ApplicationKey) error {
 // ListKeys return an list of application pointer and an error.
 func (b *B2) ListKeys(maxKeyCount int64, startApplicationKeyId string) (*ApplicationKeys, error) {
 	var (
-		url         = fmt.Sprintf("%s/b2api/v1/b2_list_keys", b.auth.ApiUrl)
+		url         = fmt.Sprintf("%s/b2api/v1/b2_list_keys", b.GetAuth().ApiUrl)
 		requestBody = &struct {
 			AccountId             string `json:"accountId"`
 			MaxKeyCount           int64  `json:"maxKeyCount,omitempty"`
 			StartApplicationKeyId string `json:"startApplicationKeyId,omitempty"`
-		}{b.auth.AccountId, maxKeyCount, startApplicationKeyId}
+		}{b.GetAuth().AccountId, maxKeyCount, startApplicationKeyId}
 		responseBody = &ApplicationKeys{}
 	)
 
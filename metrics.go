@@ -0,0 +1,264 @@
+// Copyright 2018 hryyan. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package b2
+
+import (
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultLatencyBuckets is the upper bounds in seconds of the latency histograms.
+var DefaultLatencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// errorLabel return the label used to count a failed operation.
+func errorLabel(op *Operation) string {
+	switch {
+	case op.Err != nil:
+		return "transport_error"
+	case op.ErrorCode != "":
+		return op.ErrorCode
+	default:
+		return strconv.Itoa(op.StatusCode)
+	}
+}
+
+// transferred return bytes uploaded and downloaded by a successful operation.
+func transferred(op *Operation) (int64, int64) {
+	if op.Failed() {
+		return 0, 0
+	}
+	if op.Name == "b2_upload_file" || op.Name == "b2_upload_part" {
+		return op.BytesSent, op.BytesReceived
+	}
+	return 0, op.BytesReceived
+}
+
+// ExpvarObserver export metrics of operations through package expvar.
+type ExpvarObserver struct {
+	Requests        *expvar.Map
+	Errors          *expvar.Map
+	Retries         *expvar.Map
+	Latency         *expvar.Map
+	BytesUploaded   *expvar.Int
+	BytesDownloaded *expvar.Int
+
+	mu sync.Mutex
+}
+
+// NewExpvarObserver publish a map with the given name, which holds
+// "requests", "errors", "retries", "latency_seconds", "bytes_uploaded" and "bytes_downloaded".
+// Like expvar.Publish, it panics if the name is already registered.
+func NewExpvarObserver(name string) *ExpvarObserver {
+	o := &ExpvarObserver{
+		Requests:        new(expvar.Map).Init(),
+		Errors:          new(expvar.Map).Init(),
+		Retries:         new(expvar.Map).Init(),
+		Latency:         new(expvar.Map).Init(),
+		BytesUploaded:   new(expvar.Int),
+		BytesDownloaded: new(expvar.Int),
+	}
+
+	m := expvar.NewMap(name)
+	m.Set("requests", o.Requests)
+	m.Set("errors", o.Errors)
+	m.Set("retries", o.Retries)
+	m.Set("latency_seconds", o.Latency)
+	m.Set("bytes_uploaded", o.BytesUploaded)
+	m.Set("bytes_downloaded", o.BytesDownloaded)
+	return o
+}
+
+func (o *ExpvarObserver) Observe(op *Operation) {
+	o.Requests.Add(op.Name, 1)
+	if op.Failed() {
+		o.Errors.Add(op.Name+":"+errorLabel(op), 1)
+	}
+	if op.Retry > 0 {
+		o.Retries.Add(op.Name, 1)
+	}
+
+	uploaded, downloaded := transferred(op)
+	o.BytesUploaded.Add(uploaded)
+	o.BytesDownloaded.Add(downloaded)
+
+	o.mu.Lock()
+	histogram, ok := o.Latency.Get(op.Name).(*expvar.Map)
+	if !ok {
+		histogram = new(expvar.Map).Init()
+		o.Latency.Set(op.Name, histogram)
+	}
+	o.mu.Unlock()
+
+	seconds := op.Duration.Seconds()
+	for _, bound := range DefaultLatencyBuckets {
+		if seconds <= bound {
+			histogram.Add("le_"+formatFloat(bound), 1)
+		}
+	}
+	histogram.Add("count", 1)
+	histogram.AddFloat("sum", seconds)
+}
+
+type histogram struct {
+	buckets []int64
+	count   int64
+	sum     float64
+}
+
+type errorKey struct {
+	operation string
+	code      string
+}
+
+// PrometheusObserver collect metrics of operations and
+// write them in the prometheus text exposition format.
+type PrometheusObserver struct {
+	mu              sync.Mutex
+	buckets         []float64
+	requests        map[string]int64
+	errors          map[errorKey]int64
+	retries         map[string]int64
+	latency         map[string]*histogram
+	bytesUploaded   int64
+	bytesDownloaded int64
+}
+
+// NewPrometheusObserver return a PrometheusObserver using the given latency buckets,
+// DefaultLatencyBuckets is used if buckets is empty.
+func NewPrometheusObserver(buckets []float64) *PrometheusObserver {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	buckets = append([]float64{}, buckets...)
+	sort.Float64s(buckets)
+
+	return &PrometheusObserver{
+		buckets:  buckets,
+		requests: map[string]int64{},
+		errors:   map[errorKey]int64{},
+		retries:  map[string]int64{},
+		latency:  map[string]*histogram{},
+	}
+}
+
+func (o *PrometheusObserver) Observe(op *Operation) {
+	seconds := op.Duration.Seconds()
+	uploaded, downloaded := transferred(op)
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.requests[op.Name]++
+	if op.Failed() {
+		o.errors[errorKey{op.Name, errorLabel(op)}]++
+	}
+	if op.Retry > 0 {
+		o.retries[op.Name]++
+	}
+	o.bytesUploaded += uploaded
+	o.bytesDownloaded += downloaded
+
+	h, ok := o.latency[op.Name]
+	if !ok {
+		h = &histogram{buckets: make([]int64, len(o.buckets))}
+		o.latency[op.Name] = h
+	}
+	for i, bound := range o.buckets {
+		if seconds <= bound {
+			h.buckets[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// WriteTo write all metrics to w in the prometheus text exposition format.
+func (o *PrometheusObserver) WriteTo(w io.Writer) (int64, error) {
+	var sb strings.Builder
+
+	o.mu.Lock()
+	sb.WriteString("# HELP b2_requests_total Number of requests made to b2 Cloud Storage.\n")
+	sb.WriteString("# TYPE b2_requests_total counter\n")
+	for _, name := range sortedKeys(o.requests) {
+		fmt.Fprintf(&sb, "b2_requests_total{operation=%q} %d\n", name, o.requests[name])
+	}
+
+	sb.WriteString("# HELP b2_request_errors_total Number of failed requests by b2 error code.\n")
+	sb.WriteString("# TYPE b2_request_errors_total counter\n")
+	errorKeys := make([]errorKey, 0, len(o.errors))
+	for key := range o.errors {
+		errorKeys = append(errorKeys, key)
+	}
+	sort.Slice(errorKeys, func(i, j int) bool {
+		if errorKeys[i].operation != errorKeys[j].operation {
+			return errorKeys[i].operation < errorKeys[j].operation
+		}
+		return errorKeys[i].code < errorKeys[j].code
+	})
+	for _, key := range errorKeys {
+		fmt.Fprintf(&sb, "b2_request_errors_total{operation=%q,code=%q} %d\n",
+			key.operation, key.code, o.errors[key])
+	}
+
+	sb.WriteString("# HELP b2_request_retries_total Number of requests sent again after a transient failure.\n")
+	sb.WriteString("# TYPE b2_request_retries_total counter\n")
+	for _, name := range sortedKeys(o.retries) {
+		fmt.Fprintf(&sb, "b2_request_retries_total{operation=%q} %d\n", name, o.retries[name])
+	}
+
+	sb.WriteString("# HELP b2_request_duration_seconds Latency of requests made to b2 Cloud Storage.\n")
+	sb.WriteString("# TYPE b2_request_duration_seconds histogram\n")
+	names := make([]string, 0, len(o.latency))
+	for name := range o.latency {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		h := o.latency[name]
+		for i, bound := range o.buckets {
+			fmt.Fprintf(&sb, "b2_request_duration_seconds_bucket{operation=%q,le=%q} %d\n",
+				name, formatFloat(bound), h.buckets[i])
+		}
+		fmt.Fprintf(&sb, "b2_request_duration_seconds_bucket{operation=%q,le=\"+Inf\"} %d\n", name, h.count)
+		fmt.Fprintf(&sb, "b2_request_duration_seconds_sum{operation=%q} %s\n", name, formatFloat(h.sum))
+		fmt.Fprintf(&sb, "b2_request_duration_seconds_count{operation=%q} %d\n", name, h.count)
+	}
+
+	sb.WriteString("# HELP b2_bytes_uploaded_total Bytes uploaded to b2 Cloud Storage.\n")
+	sb.WriteString("# TYPE b2_bytes_uploaded_total counter\n")
+	fmt.Fprintf(&sb, "b2_bytes_uploaded_total %d\n", o.bytesUploaded)
+	sb.WriteString("# HELP b2_bytes_downloaded_total Bytes downloaded from b2 Cloud Storage.\n")
+	sb.WriteString("# TYPE b2_bytes_downloaded_total counter\n")
+	fmt.Fprintf(&sb, "b2_bytes_downloaded_total %d\n", o.bytesDownloaded)
+	o.mu.Unlock()
+
+	n, err := io.WriteString(w, sb.String())
+	return int64(n), err
+}
+
+// ServeHTTP make PrometheusObserver a handler for the scrape endpoint.
+func (o *PrometheusObserver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	o.WriteTo(w)
+}
+
+func sortedKeys(m map[string]int64) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -32,27 +32,14 @@ type Bucket struct {
 const PUBLIC = "allPublic"
 const PRIVATE = "allPrivate"
 
-// Capability
-const LIST_KEYS = "listKeys"
-const WRITE_KEYS = "writeKeys"
-const DELETE_KEYS = "deleteKeys"
-const LIST_BUCKETS = "listBuckets"
-const WRITE_BUCKETS = "writeBuckets"
-const DELETE_BUCKETS = "deleteBuckets"
-const LIST_FILES = "listFiles"
-const READ_FILES = "readFiles"
-const SHARE_FILES = "shareFiles"
-const WRITE_FILES = "writeFiles"
-const DELETE_FILES = "deleteFiles"
-
 type ApplicationKey struct {
-	ApplicationKeyId    string   `json:"applicationKeyId"`
-	ApplicationKey      string   `json:"applicationKey"`
-	KeyName             string   `json:"keyName"`
-	Capabilities        []string `json:"capabilities"`
-	ExpirationTimestamp int64    `json:"expirationTimestamp,omitempty"`
-	BucketId            string   `json:"bucketId,omitempty"`
-	NamePrefix          string   `json:"namePrefix,omitempty"`
+	ApplicationKeyId    string       `json:"applicationKeyId"`
+	ApplicationKey      string       `json:"applicationKey"`
+	KeyName             string       `json:"keyName"`
+	Capabilities        []Capability `json:"capabilities"`
+	ExpirationTimestamp int64        `json:"expirationTimestamp,omitempty"`
+	BucketId            string       `json:"bucketId,omitempty"`
+	NamePrefix          string       `json:"namePrefix,omitempty"`
 }
 
 type ApplicationKeys struct {
@@ -73,6 +60,27 @@ type File struct {
 	UploadTimestamp int64    `json:"uploadTimestamp"`
 }
 
+type FileNames struct {
+	Files        []*File `json:"files"`
+	NextFileName string  `json:"nextFileName,omitempty"`
+}
+
+type FileVersions struct {
+	Files        []*File `json:"files"`
+	NextFileName string  `json:"nextFileName,omitempty"`
+	NextFileId   string  `json:"nextFileId,omitempty"`
+}
+
+type UnfinishedLargeFiles struct {
+	Files      []*File `json:"files"`
+	NextFileId string  `json:"nextFileId,omitempty"`
+}
+
+type Parts struct {
+	Parts          []*Part `json:"parts"`
+	NextPartNumber int64   `json:"nextPartNumber,omitempty"`
+}
+
 type DownloadUrlToken struct {
 	FileNamePrefix     string `json:"fileNamePrefix"`
 	AuthorizationToken string `json:"authorizationToken"`
@@ -87,6 +95,7 @@ type Part struct {
 	FileId          string `json:"fileId"`
 	PartNumber      int64  `json:"partNumber"`
 	ContentType     int64  `json:"contentType"`
+	ContentLength   int64  `json:"contentLength"`
 	ContentSha1     string `json:"contentSha1"`
 	UploadTimestamp int64  `json:"uploadTimestamp"`
 }
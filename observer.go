@@ -0,0 +1,169 @@
+// Copyright 2018 hryyan. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package b2
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// retryBackoff is the delay before the first retry of a request, it doubles with every
+// retry unless the response asks for a delay with Retry-After.
+var retryBackoff = time.Second
+
+// Operation describes a finished call to b2 Cloud Storage.
+type Operation struct {
+	// Name is the b2 api name, such as "b2_list_file_names".
+	Name string
+	// StatusCode is the http status code, 0 if no response was received.
+	StatusCode int
+	// ErrorCode is the b2 error code carried by a failed response, such as "bad_request".
+	ErrorCode string
+	// Err is the transport error, nil if a response was received.
+	Err error
+	// Duration is the time spent until the response headers arrived.
+	Duration time.Duration
+	// BytesSent is the size of the request body.
+	BytesSent int64
+	// BytesReceived is the content length reported by a successful download or range.
+	BytesReceived int64
+	// Retry is 0 for the first attempt of a request and n for its nth retry.
+	Retry int
+}
+
+// Failed report whether the operation returned an error to the caller.
+func (op *Operation) Failed() bool {
+	return op.Err != nil || !succeeded(op.StatusCode)
+}
+
+// succeeded report whether status is a 2xx status, such as 206 of a range download.
+func succeeded(status int) bool {
+	return status >= 200 && status < 300
+}
+
+// Observer is invoked after every request made by a B2 client.
+// Observers may be called from multiple goroutines at the same time.
+type Observer interface {
+	Observe(op *Operation)
+}
+
+// ObserverFunc adapts an ordinary function to an Observer.
+type ObserverFunc func(op *Operation)
+
+func (f ObserverFunc) Observe(op *Operation) {
+	f(op)
+}
+
+// MultiObserver forward every operation to all observers in order.
+func MultiObserver(observers ...Observer) Observer {
+	return ObserverFunc(func(op *Operation) {
+		for _, observer := range observers {
+			observer.Observe(op)
+		}
+	})
+}
+
+// doRequest send the request, retry it up to b.MaxRetries times if it failed
+// transiently, and report every attempt to the observer of b.
+func (b *B2) doRequest(name string, request *http.Request, bytesSent int64) (*http.Response, error) {
+	client := &http.Client{}
+	for retry := 0; ; retry++ {
+		start := time.Now()
+		response, err := client.Do(request)
+		b.observe(name, request, response, err, retry, time.Since(start), bytesSent)
+
+		if retry >= b.MaxRetries || !retryable(response, err) || !rewind(request) {
+			return response, err
+		}
+
+		delay := retryDelay(response, retry)
+		if response != nil {
+			response.Body.Close()
+		}
+		time.Sleep(delay)
+	}
+}
+
+func (b *B2) observe(name string, request *http.Request, response *http.Response, err error,
+	retry int, duration time.Duration, bytesSent int64) {
+	if b.Observer == nil {
+		return
+	}
+
+	op := &Operation{
+		Name:      name,
+		Err:       err,
+		Duration:  duration,
+		BytesSent: bytesSent,
+		Retry:     retry,
+	}
+	if response != nil {
+		op.StatusCode = response.StatusCode
+		if succeeded(response.StatusCode) {
+			if request.Method == "GET" && response.ContentLength > 0 {
+				op.BytesReceived = response.ContentLength
+			}
+		} else {
+			op.ErrorCode = peekErrorCode(response)
+		}
+	}
+	b.Observer.Observe(op)
+}
+
+// retryable report whether a request may succeed if it is sent again.
+func retryable(response *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	status := response.StatusCode
+	return status == 408 || status == 429 || status >= 500
+}
+
+// rewind prepare the body of request to be sent again, it return false if it can not.
+func rewind(request *http.Request) bool {
+	if request.Body == nil {
+		return true
+	}
+	if request.GetBody == nil {
+		return false
+	}
+	body, err := request.GetBody()
+	if err != nil {
+		return false
+	}
+	request.Body = body
+	return true
+}
+
+// retryDelay return the delay before the next retry, as asked by Retry-After if present.
+func retryDelay(response *http.Response, retry int) time.Duration {
+	if response != nil {
+		if seconds, err := strconv.Atoi(response.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second
+		}
+	}
+	return retryBackoff << uint(retry)
+}
+
+// peekErrorCode read the error code from a failed response and
+// restore the body so that it can be handled as usual.
+func peekErrorCode(response *http.Response) string {
+	body, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	response.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return ""
+	}
+
+	var errorResponse ErrorResponse
+	if err := json.Unmarshal(body, &errorResponse); err != nil {
+		return ""
+	}
+	return errorResponse.Code
+}
@@ -0,0 +1,242 @@
+// Copyright 2018 hryyan. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package b2
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder keep the observed operations.
+type recorder struct {
+	mu  sync.Mutex
+	ops []*Operation
+}
+
+func (r *recorder) Observe(op *Operation) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ops = append(r.ops, op)
+}
+
+func (r *recorder) named(name string) []*Operation {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var ops []*Operation
+	for _, op := range r.ops {
+		if op.Name == name {
+			ops = append(ops, op)
+		}
+	}
+	return ops
+}
+
+func noBackoff(t *testing.T) {
+	backoff := retryBackoff
+	retryBackoff = 0
+	t.Cleanup(func() { retryBackoff = backoff })
+}
+
+func TestRetries(t *testing.T) {
+	noBackoff(t)
+	fs := newFakeServer(t)
+	fs.addBucket("logs")
+
+	client := fs.authedClient(t)
+	rec := &recorder{}
+	client.Observer = rec
+	client.MaxRetries = 2
+
+	fs.failNext("b2_list_buckets", 2)
+	if _, err := client.ListBuckets("", "", ""); err != nil {
+		t.Fatalf("List buckets should succeed after retries: %s", err.Error())
+	}
+
+	ops := rec.named("b2_list_buckets")
+	if len(ops) != 3 {
+		t.Fatalf("Should make 3 attempts, got %d", len(ops))
+	}
+	for i, op := range ops {
+		if op.Retry != i {
+			t.Fatalf("Attempt %d should be retry %d, got %d", i, i, op.Retry)
+		}
+	}
+	if ops[0].StatusCode != 503 || ops[0].ErrorCode != "service_unavailable" || ops[2].Failed() {
+		t.Fatalf("Wrong attempts %+v %+v", ops[0], ops[2])
+	}
+
+	fs.failNext("b2_list_buckets", 3)
+	_, err := client.ListBuckets("", "", "")
+	if code := ErrorCode(err); code != "service_unavailable" {
+		t.Fatalf("List buckets should fail once retries are exhausted, got %v", err)
+	}
+
+	client.MaxRetries = 0
+	fs.failNext("b2_list_buckets", 1)
+	if _, err = client.ListBuckets("", "", ""); err == nil {
+		t.Fatal("List buckets should not be retried with MaxRetries 0")
+	}
+	if n := len(rec.named("b2_list_buckets")); n != 7 {
+		t.Fatalf("Should make 7 attempts in total, got %d", n)
+	}
+}
+
+func TestMultiObserver(t *testing.T) {
+	fs := newFakeServer(t)
+	first, second := &recorder{}, &recorder{}
+
+	client := fs.client(fs.accountId, fs.masterKey)
+	client.Observer = MultiObserver(first, second)
+	if err := client.Auth(); err != nil {
+		t.Fatalf("Auth failed: %s", err.Error())
+	}
+
+	for _, rec := range []*recorder{first, second} {
+		ops := rec.named("b2_authorize_account")
+		if len(ops) != 1 || ops[0].StatusCode != 200 {
+			t.Fatalf("Every observer should see the authorization, got %v", ops)
+		}
+	}
+}
+
+// streamWriter signal started on its first write.
+type streamWriter struct {
+	bytes.Buffer
+	once    sync.Once
+	started chan struct{}
+}
+
+func (w *streamWriter) Write(p []byte) (int, error) {
+	w.once.Do(func() { close(w.started) })
+	return w.Buffer.Write(p)
+}
+
+func TestObserveRange(t *testing.T) {
+	w := &streamWriter{started: make(chan struct{})}
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Range", "bytes 0-9/20")
+		rw.Header().Set("Content-Length", "10")
+		rw.WriteHeader(206)
+		rw.Write([]byte("01234"))
+		rw.(http.Flusher).Flush()
+
+		// the rest is sent once the client wrote the first bytes
+		select {
+		case <-w.started:
+		case <-time.After(5 * time.Second):
+			t.Error("Range body should be streamed, not read by the observer")
+		}
+		rw.Write([]byte("56789"))
+	}))
+	defer ts.Close()
+
+	rec := &recorder{}
+	client := &B2{Observer: rec}
+	client.SetAuth(AuthResponse{AuthorizationToken: "token", DownloadUrl: ts.URL})
+	if err := client.DownloadFileRangeById("file0001", 0, 9, w, true, nil); err != nil {
+		t.Fatalf("Download range failed: %s", err.Error())
+	}
+	if w.String() != "0123456789" {
+		t.Fatalf("Wrong range %q", w.String())
+	}
+
+	ops := rec.named("b2_download_file_by_id")
+	if len(ops) != 1 || ops[0].StatusCode != 206 || ops[0].Failed() || ops[0].ErrorCode != "" || ops[0].BytesReceived != 10 {
+		t.Fatalf("Range should be observed as a success of 10 bytes, got %+v", ops)
+	}
+}
+
+// observe make a successful list, a failed and retried download authorization
+// and a download of 11 bytes.
+func observe(t *testing.T, observer Observer) {
+	noBackoff(t)
+	fs := newFakeServer(t)
+	bucket := fs.addBucket("logs")
+	fs.addContent(bucket.BucketId, "app.log", "hello world")
+
+	client := fs.authedClient(t)
+	client.Observer = observer
+	client.MaxRetries = 1
+
+	if _, err := client.ListBuckets("", "", ""); err != nil {
+		t.Fatalf("List buckets failed: %s", err.Error())
+	}
+	fs.failNext("b2_get_download_authorization", 1)
+	if _, err := client.GetDownloadAuthorization(bucket.BucketId, "app", 0); err == nil {
+		t.Fatal("Get download authorization of 0 seconds should fail")
+	}
+	var buf bytes.Buffer
+	if err := client.DownloadFileByNameTo("logs", "app.log", &buf, true, nil); err != nil {
+		t.Fatalf("Download failed: %s", err.Error())
+	}
+}
+
+func TestExpvarObserver(t *testing.T) {
+	o := NewExpvarObserver("b2_test_expvar_observer")
+	observe(t, o)
+
+	for _, check := range []struct {
+		name string
+		got  interface{ String() string }
+		want string
+	}{
+		{"requests", o.Requests.Get("b2_list_buckets"), "1"},
+		{"requests", o.Requests.Get("b2_get_download_authorization"), "2"},
+		{"errors", o.Errors.Get("b2_get_download_authorization:service_unavailable"), "1"},
+		{"errors", o.Errors.Get("b2_get_download_authorization:bad_request"), "1"},
+		{"retries", o.Retries.Get("b2_get_download_authorization"), "1"},
+		{"bytes_downloaded", o.BytesDownloaded, "11"},
+		{"bytes_uploaded", o.BytesUploaded, "0"},
+	} {
+		if check.got == nil || check.got.String() != check.want {
+			t.Fatalf("Wrong %s %v, want %s", check.name, check.got, check.want)
+		}
+	}
+	if o.Retries.Get("b2_list_buckets") != nil {
+		t.Fatal("List buckets should not be retried")
+	}
+
+	histogram := o.Latency.Get("b2_list_buckets").String()
+	if !strings.Contains(histogram, `"count": 1`) || !strings.Contains(histogram, `"le_60": 1`) {
+		t.Fatalf("Wrong latency histogram %s", histogram)
+	}
+}
+
+func TestPrometheusObserver(t *testing.T) {
+	o := NewPrometheusObserver([]float64{60, 30})
+	observe(t, o)
+
+	var buf bytes.Buffer
+	if _, err := o.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	text := buf.String()
+
+	for _, line := range []string{
+		`b2_requests_total{operation="b2_list_buckets"} 1`,
+		`b2_requests_total{operation="b2_get_download_authorization"} 2`,
+		`b2_request_errors_total{operation="b2_get_download_authorization",code="bad_request"} 1`,
+		`b2_request_errors_total{operation="b2_get_download_authorization",code="service_unavailable"} 1`,
+		`b2_request_retries_total{operation="b2_get_download_authorization"} 1`,
+		`b2_request_duration_seconds_bucket{operation="b2_list_buckets",le="30"} 1`,
+		`b2_request_duration_seconds_bucket{operation="b2_list_buckets",le="60"} 1`,
+		`b2_request_duration_seconds_bucket{operation="b2_list_buckets",le="+Inf"} 1`,
+		`b2_request_duration_seconds_count{operation="b2_list_buckets"} 1`,
+		"b2_bytes_uploaded_total 0",
+		"b2_bytes_downloaded_total 11",
+	} {
+		if !strings.Contains(text, line+"\n") {
+			t.Fatalf("Missing %s in\n%s", line, text)
+		}
+	}
+	if strings.Index(text, `le="30"`) > strings.Index(text, `le="60"`) {
+		t.Fatal("Latency buckets should be sorted")
+	}
+}
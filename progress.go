@@ -0,0 +1,149 @@
+// Copyright 2018 hryyan. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package b2
+
+import (
+	"sync"
+)
+
+type ProgressEventType int
+
+const (
+	TransferStarted ProgressEventType = iota
+	PartStarted
+	PartFinished
+	PartRetried
+	BytesTransferred
+	TransferFinished
+	TransferFailed
+)
+
+var progressEventNames = [...]string{
+	"transfer_started",
+	"part_started",
+	"part_finished",
+	"part_retried",
+	"bytes_transferred",
+	"transfer_finished",
+	"transfer_failed",
+}
+
+func (t ProgressEventType) String() string {
+	if t < 0 || int(t) >= len(progressEventNames) {
+		return "unknown"
+	}
+	return progressEventNames[t]
+}
+
+// ProgressEvent describes the progress of an upload or a download.
+type ProgressEvent struct {
+	Type     ProgressEventType
+	FileName string
+	// PartNumber is the part of a large file, 0 if the event is not about a part.
+	PartNumber int64
+	// Bytes is the change of Done, negative for a retried part.
+	Bytes int64
+	// PartDone and PartSize are the progress of the part.
+	PartDone int64
+	PartSize int64
+	// Done and Total are the progress of the whole transfer, Total is 0 if unknown.
+	Done  int64
+	Total int64
+	// Err is set for PartRetried and TransferFailed events.
+	Err error
+}
+
+// ProgressListener receives progress events.
+// Events of parallel parts may be delivered from multiple goroutines at the same time.
+type ProgressListener interface {
+	OnProgress(event *ProgressEvent)
+}
+
+// ProgressListenerFunc adapts an ordinary function to a ProgressListener.
+type ProgressListenerFunc func(event *ProgressEvent)
+
+func (f ProgressListenerFunc) OnProgress(event *ProgressEvent) {
+	f(event)
+}
+
+// Transfer aggregates the progress of all parts of a file.
+// Pass a Transfer as the listener of UploadPart to report parallel parts as a single file.
+type Transfer struct {
+	FileName string
+	Total    int64
+	Listener ProgressListener
+
+	mu    sync.Mutex
+	done  int64
+	parts map[int64]int64
+}
+
+// NewTransfer return a Transfer forwarding aggregated events to listener, listener can be nil.
+func NewTransfer(fileName string, total int64, listener ProgressListener) *Transfer {
+	return &Transfer{
+		FileName: fileName,
+		Total:    total,
+		Listener: listener,
+		parts:    map[int64]int64{},
+	}
+}
+
+// Done return the bytes transferred so far.
+func (t *Transfer) Done() int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.done
+}
+
+// Start emit a TransferStarted event.
+func (t *Transfer) Start() {
+	t.emit(&ProgressEvent{Type: TransferStarted})
+}
+
+// Finish emit a TransferFinished event, or a TransferFailed event if err is not nil.
+func (t *Transfer) Finish(err error) {
+	if err != nil {
+		t.emit(&ProgressEvent{Type: TransferFailed, Err: err})
+	} else {
+		t.emit(&ProgressEvent{Type: TransferFinished})
+	}
+}
+
+// RetryPart discard the bytes of a failed part and emit a PartRetried event.
+func (t *Transfer) RetryPart(partNumber int64, err error) {
+	t.mu.Lock()
+	discarded := t.parts[partNumber]
+	delete(t.parts, partNumber)
+	t.mu.Unlock()
+
+	t.emit(&ProgressEvent{
+		Type:       PartRetried,
+		PartNumber: partNumber,
+		Bytes:      -discarded,
+		Err:        err,
+	})
+}
+
+// OnProgress aggregate an event of a single part.
+func (t *Transfer) OnProgress(event *ProgressEvent) {
+	aggregated := *event
+	t.emit(&aggregated)
+}
+
+func (t *Transfer) emit(event *ProgressEvent) {
+	t.mu.Lock()
+	if event.Type == BytesTransferred {
+		t.parts[event.PartNumber] += event.Bytes
+	}
+	t.done += event.Bytes
+	event.Done = t.done
+	t.mu.Unlock()
+
+	event.FileName = t.FileName
+	event.Total = t.Total
+	if t.Listener != nil {
+		t.Listener.OnProgress(event)
+	}
+}
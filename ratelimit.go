@@ -0,0 +1,123 @@
+// Copyright 2018 hryyan. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package b2
+
+import (
+	"sync"
+	"time"
+)
+
+// RateWindow overrides the rate of a RateLimiter during a time of day.
+// Start and End are offsets from midnight in local time, a window whose
+// End is before its Start wraps around midnight.
+// BytesPerSecond <= 0 means unlimited during the window.
+type RateWindow struct {
+	Start          time.Duration
+	End            time.Duration
+	BytesPerSecond int64
+}
+
+func (w RateWindow) contains(offset time.Duration) bool {
+	if w.Start <= w.End {
+		return offset >= w.Start && offset < w.End
+	}
+	return offset >= w.Start || offset < w.End
+}
+
+// RateLimiter is a token bucket limiting the bandwidth of uploads and downloads.
+// One RateLimiter can be shared by all transfers of a client.
+type RateLimiter struct {
+	mu             sync.Mutex
+	bytesPerSecond int64
+	burst          int64
+	schedule       []RateWindow
+	tokens         float64
+	last           time.Time
+
+	// now and sleep default to time.Now and time.Sleep, tests replace them with a fake clock.
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+// NewRateLimiter return a RateLimiter allowing bytesPerSecond bytes per second
+// with bursts of at most burst bytes. If burst <= 0, one second of traffic is allowed.
+// bytesPerSecond <= 0 means unlimited.
+func NewRateLimiter(bytesPerSecond, burst int64) *RateLimiter {
+	return &RateLimiter{
+		bytesPerSecond: bytesPerSecond,
+		burst:          burst,
+		now:            time.Now,
+		sleep:          time.Sleep,
+	}
+}
+
+// SetSchedule replace the time of day windows of the limiter,
+// the first window containing the current time wins.
+func (l *RateLimiter) SetSchedule(schedule []RateWindow) {
+	l.mu.Lock()
+	l.schedule = append([]RateWindow{}, schedule...)
+	l.mu.Unlock()
+}
+
+// rate return the rate and burst in effect at now.
+func (l *RateLimiter) rate(now time.Time) (int64, int64) {
+	rate := l.bytesPerSecond
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	offset := now.Sub(midnight)
+	for _, window := range l.schedule {
+		if window.contains(offset) {
+			rate = window.BytesPerSecond
+			break
+		}
+	}
+
+	burst := l.burst
+	if burst <= 0 {
+		burst = rate
+	}
+	return rate, burst
+}
+
+// WaitN block until n bytes can be transferred.
+func (l *RateLimiter) WaitN(n int64) {
+	for n > 0 {
+		l.mu.Lock()
+		now := l.now()
+		rate, burst := l.rate(now)
+		if rate <= 0 {
+			l.tokens = 0
+			l.last = now
+			l.mu.Unlock()
+			return
+		}
+
+		if !l.last.IsZero() {
+			l.tokens += now.Sub(l.last).Seconds() * float64(rate)
+		} else {
+			l.tokens = float64(burst)
+		}
+		if l.tokens > float64(burst) {
+			l.tokens = float64(burst)
+		}
+		l.last = now
+
+		chunk := n
+		if chunk > burst {
+			chunk = burst
+		}
+		l.tokens -= float64(chunk)
+		n -= chunk
+
+		var wait time.Duration
+		if l.tokens < 0 {
+			wait = time.Duration(-l.tokens / float64(rate) * float64(time.Second))
+		}
+		l.mu.Unlock()
+
+		if wait > 0 {
+			l.sleep(wait)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2018 hryyan. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package b2
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeClock is advanced only by the sleeps of a RateLimiter and by tests.
+type fakeClock struct {
+	now   time.Time
+	slept time.Duration
+}
+
+func newFakeClock(l *RateLimiter, hour, minute int) *fakeClock {
+	c := &fakeClock{now: time.Date(2018, 6, 1, hour, minute, 0, 0, time.Local)}
+	l.now = func() time.Time { return c.now }
+	l.sleep = func(d time.Duration) {
+		c.now = c.now.Add(d)
+		c.slept += d
+	}
+	return c
+}
+
+// waited return the time slept since the last call.
+func (c *fakeClock) waited() time.Duration {
+	slept := c.slept
+	c.slept = 0
+	return slept
+}
+
+func assertWaited(t *testing.T, c *fakeClock, want time.Duration) {
+	t.Helper()
+	got := c.waited()
+	if got < want-time.Millisecond || got > want+time.Millisecond {
+		t.Fatalf("Should wait %s, waited %s", want, got)
+	}
+}
+
+func TestRateLimiterBurst(t *testing.T) {
+	l := NewRateLimiter(100, 50)
+	c := newFakeClock(l, 12, 0)
+
+	l.WaitN(50)
+	assertWaited(t, c, 0)
+	l.WaitN(50)
+	assertWaited(t, c, 500*time.Millisecond)
+
+	// idle time refills at most burst bytes
+	c.now = c.now.Add(10 * time.Second)
+	l.WaitN(50)
+	assertWaited(t, c, 0)
+	l.WaitN(100)
+	assertWaited(t, c, time.Second)
+}
+
+func TestRateLimiterDefaultBurst(t *testing.T) {
+	l := NewRateLimiter(100, 0)
+	c := newFakeClock(l, 12, 0)
+
+	l.WaitN(100)
+	assertWaited(t, c, 0)
+	l.WaitN(100)
+	assertWaited(t, c, time.Second)
+}
+
+func TestRateLimiterLargeWait(t *testing.T) {
+	l := NewRateLimiter(100, 10)
+	c := newFakeClock(l, 12, 0)
+
+	// the first burst is free, the other 90 bytes are sent in chunks of 10
+	l.WaitN(100)
+	assertWaited(t, c, 900*time.Millisecond)
+}
+
+func TestRateLimiterUnlimited(t *testing.T) {
+	l := NewRateLimiter(0, 0)
+	c := newFakeClock(l, 12, 0)
+
+	l.WaitN(1 << 30)
+	assertWaited(t, c, 0)
+}
+
+func TestRateLimiterSchedule(t *testing.T) {
+	l := NewRateLimiter(100, 0)
+	c := newFakeClock(l, 2, 0)
+	l.SetSchedule([]RateWindow{
+		{Start: time.Hour, End: 3 * time.Hour, BytesPerSecond: 0},
+		{Start: 23 * time.Hour, End: time.Hour, BytesPerSecond: 10},
+		{Start: 0, End: 24 * time.Hour, BytesPerSecond: 50},
+	})
+
+	l.WaitN(1 << 30)
+	assertWaited(t, c, 0)
+
+	day := time.Date(2018, 6, 1, 0, 0, 0, 0, time.Local)
+	for _, check := range []struct {
+		at   time.Duration
+		rate int64
+	}{
+		{30 * time.Minute, 10},
+		{23*time.Hour + 30*time.Minute, 10},
+		{time.Hour, 0},
+		{3 * time.Hour, 50},
+		{12 * time.Hour, 50},
+	} {
+		if rate, burst := l.rate(day.Add(check.at)); rate != check.rate || burst != check.rate {
+			t.Fatalf("Rate at %s should be %d, got %d with burst %d", check.at, check.rate, rate, burst)
+		}
+	}
+
+	l.SetSchedule(nil)
+	if rate, _ := l.rate(day.Add(2 * time.Hour)); rate != 100 {
+		t.Fatalf("Rate without a schedule should be 100, got %d", rate)
+	}
+
+	c.now = day.Add(4 * time.Hour)
+	l.WaitN(100)
+	assertWaited(t, c, 0)
+	l.WaitN(50)
+	assertWaited(t, c, 500*time.Millisecond)
+}
+
+func TestRateWindowContains(t *testing.T) {
+	day := RateWindow{Start: 9 * time.Hour, End: 17 * time.Hour}
+	night := RateWindow{Start: 22 * time.Hour, End: 6 * time.Hour}
+
+	for _, check := range []struct {
+		window RateWindow
+		offset time.Duration
+		want   bool
+	}{
+		{day, 9 * time.Hour, true},
+		{day, 17 * time.Hour, false},
+		{day, 8 * time.Hour, false},
+		{night, 23 * time.Hour, true},
+		{night, 5 * time.Hour, true},
+		{night, 6 * time.Hour, false},
+		{night, 12 * time.Hour, false},
+	} {
+		if got := check.window.contains(check.offset); got != check.want {
+			t.Fatalf("%+v contains %s should be %v", check.window, check.offset, check.want)
+		}
+	}
+}
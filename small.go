@@ -7,6 +7,7 @@ package b2
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -20,7 +21,7 @@ import (
 // GetUploadUrl return a UploadUrlToken pointer and an error.
 func (b *B2) GetUploadUrl(bucketId string) (*UploadUrlToken, error) {
 	var (
-		url         = fmt.Sprintf("%s/b2api/v1/b2_get_upload_url", b.auth.ApiUrl)
+		url         = fmt.Sprintf("%s/b2api/v1/b2_get_upload_url", b.GetAuth().ApiUrl)
 		requestBody = struct {
 			BucketId string `json:"bucketId"`
 		}{BucketId: bucketId}
@@ -49,9 +50,19 @@ func (b *B2) GetUploadUrl(bucketId string) (*UploadUrlToken, error) {
 // See "b2_upload_file" for an introduction:
 // https://www.backblaze.com/b2/docs/b2_upload_file.html
 //
-// Parameter uploadUrlToken and filePath are required.
+// Parameter uploadUrlToken and filePath are required, listener can be nil.
+// The file is named after the base name of filePath.
 // UploadFile return a File pointer and an error.
-func (b *B2) UploadFile(uploadUrlToken *UploadUrlToken, filePath string, progress func(int64, int64)) (*File, error) {
+func (b *B2) UploadFile(uploadUrlToken *UploadUrlToken, filePath string, listener ProgressListener) (*File, error) {
+	return b.UploadFileAs(uploadUrlToken, filePath, filepath.Base(filePath), listener)
+}
+
+// UploadFileAs upload file to b2 Close Storage as fileName, such as "site/css/main.css".
+//
+// Parameter uploadUrlToken, filePath and fileName are required, listener can be nil.
+// UploadFileAs return a File pointer and an error.
+func (b *B2) UploadFileAs(uploadUrlToken *UploadUrlToken, filePath, fileName string,
+	listener ProgressListener) (*File, error) {
 	f, err := os.Open(filePath)
 	if err != nil {
 		return nil, err
@@ -64,16 +75,42 @@ func (b *B2) UploadFile(uploadUrlToken *UploadUrlToken, filePath string, progres
 	}
 
 	buf := make([]byte, fi.Size())
-	if _, err := f.Read(buf); err != nil {
+	if _, err := io.ReadFull(f, buf); err != nil {
 		return nil, err
 	}
 
 	headers := map[string]string{
-		"X-Bz-File-Name":                     filepath.Base(filePath),
+		"X-Bz-File-Name":                     EncodeFileName(fileName),
 		"X-Bz-Info-src_last_modified_millis": fmt.Sprintf("%d", fi.ModTime().Unix()*1000),
 	}
 
-	response, _, err := b.makeUploadRequest(uploadUrlToken, buf, headers, progress)
+	transfer := NewTransfer(fileName, fi.Size(), listener)
+	transfer.Start()
+	file, err := b.uploadFile(uploadUrlToken, buf, headers, transfer)
+	transfer.Finish(err)
+	return file, err
+}
+
+// UploadBytes upload data held in memory as fileName, such as data read from a stream.
+//
+// Parameter uploadUrlToken and fileName are required, listener can be nil.
+// UploadBytes return a File pointer and an error.
+func (b *B2) UploadBytes(uploadUrlToken *UploadUrlToken, buf []byte, fileName string,
+	listener ProgressListener) (*File, error) {
+	headers := map[string]string{
+		"X-Bz-File-Name": EncodeFileName(fileName),
+	}
+
+	transfer := NewTransfer(fileName, int64(len(buf)), listener)
+	transfer.Start()
+	file, err := b.uploadFile(uploadUrlToken, buf, headers, transfer)
+	transfer.Finish(err)
+	return file, err
+}
+
+func (b *B2) uploadFile(uploadUrlToken *UploadUrlToken, buf []byte, headers map[string]string,
+	listener ProgressListener) (*File, error) {
+	response, _, err := b.makeUploadRequest(uploadUrlToken, buf, headers, 0, listener)
 	if err != nil {
 		return nil, err
 	}
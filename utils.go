@@ -12,31 +12,60 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
+	"path"
+	"strings"
+	"sync/atomic"
 )
 
+// ProgressReaderWriter report BytesTransferred events while reading or writing.
+// Done is updated atomically, so Read and Write can be called from any goroutine.
 type ProgressReaderWriter struct {
-	Reader io.Reader
-	Writer io.Writer
-	Total  int64
-	Done   int64
-	Report func(int64, int64)
+	Reader     io.Reader
+	Writer     io.Writer
+	Total      int64
+	Done       int64
+	PartNumber int64
+	Listener   ProgressListener
+	Limiter    *RateLimiter
 }
 
 func (prw *ProgressReaderWriter) Read(p []byte) (int, error) {
 	n, err := prw.Reader.Read(p)
-	prw.Done += int64(n)
-	prw.Report(prw.Done, prw.Total)
+	if prw.Limiter != nil {
+		prw.Limiter.WaitN(int64(n))
+	}
+	prw.report(n)
 	return n, err
 }
 
 func (prw *ProgressReaderWriter) Write(p []byte) (int, error) {
+	if prw.Limiter != nil {
+		prw.Limiter.WaitN(int64(len(p)))
+	}
 	n, err := prw.Writer.Write(p)
-	prw.Done += int64(n)
-	prw.Report(prw.Done, prw.Total)
+	prw.report(n)
 	return n, err
 }
 
+func (prw *ProgressReaderWriter) report(n int) {
+	done := atomic.AddInt64(&prw.Done, int64(n))
+	if prw.Listener == nil || n == 0 {
+		return
+	}
+
+	prw.Listener.OnProgress(&ProgressEvent{
+		Type:       BytesTransferred,
+		PartNumber: prw.PartNumber,
+		Bytes:      int64(n),
+		PartDone:   done,
+		PartSize:   prw.Total,
+		Done:       done,
+		Total:      prw.Total,
+	})
+}
+
 func (b *B2) makeAuthedRequest(url string, s interface{}) (*http.Response, error) {
 	body, err := json.Marshal(s)
 	if err != nil {
@@ -47,10 +76,9 @@ func (b *B2) makeAuthedRequest(url string, s interface{}) (*http.Response, error
 	if err != nil {
 		return nil, err
 	}
-	request.Header.Set("Authorization", b.auth.AuthorizationToken)
+	request.Header.Set("Authorization", b.GetAuth().AuthorizationToken)
 
-	client := &http.Client{}
-	response, err := client.Do(request)
+	response, err := b.doRequest(path.Base(url), request, int64(len(body)))
 	if err != nil {
 		return nil, err
 	}
@@ -58,12 +86,17 @@ func (b *B2) makeAuthedRequest(url string, s interface{}) (*http.Response, error
 	return response, nil
 }
 
-func (b *B2) makeDownloadRequest(url string, queries map[string]string, needAuth bool) (*http.Response, error) {
+func (b *B2) makeDownloadRequest(url string, queries, headers map[string]string,
+	needAuth bool) (*http.Response, error) {
 	request, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
 
+	for key, value := range headers {
+		request.Header.Set(key, value)
+	}
+
 	q := request.URL.Query()
 	for key, value := range queries {
 		q.Add(key, value)
@@ -71,11 +104,15 @@ func (b *B2) makeDownloadRequest(url string, queries map[string]string, needAuth
 	request.URL.RawQuery = q.Encode()
 
 	if needAuth {
-		request.Header.Set("Authorization", b.auth.AuthorizationToken)
+		request.Header.Set("Authorization", b.GetAuth().AuthorizationToken)
+	}
+
+	name := "b2_download_file_by_name"
+	if strings.HasSuffix(url, "/b2_download_file_by_id") {
+		name = "b2_download_file_by_id"
 	}
 
-	client := &http.Client{}
-	response, err := client.Do(request)
+	response, err := b.doRequest(name, request, 0)
 	if err != nil {
 		return nil, err
 	}
@@ -84,14 +121,16 @@ func (b *B2) makeDownloadRequest(url string, queries map[string]string, needAuth
 }
 
 func (b *B2) makeUploadRequest(uploadUrlToken *UploadUrlToken, body []byte,
-	headers map[string]string, report func(int64, int64)) (*http.Response, string, error) {
+	headers map[string]string, partNumber int64, listener ProgressListener) (*http.Response, string, error) {
 	var (
 		h              = sha1.New()
 		contentSha1    = ""
 		progressReader = ProgressReaderWriter{
-			Reader: bytes.NewReader(body),
-			Total:  int64(len(body)),
-			Report: report,
+			Reader:     bytes.NewReader(body),
+			Total:      int64(len(body)),
+			PartNumber: partNumber,
+			Listener:   listener,
+			Limiter:    b.Limiter,
 		}
 	)
 
@@ -114,8 +153,12 @@ func (b *B2) makeUploadRequest(uploadUrlToken *UploadUrlToken, body []byte,
 		request.Header.Set(key, value)
 	}
 
-	client := &http.Client{}
-	response, err := client.Do(request)
+	name := "b2_upload_file"
+	if partNumber > 0 {
+		name = "b2_upload_part"
+	}
+
+	response, err := b.doRequest(name, request, int64(len(body)))
 	if err != nil {
 		return nil, contentSha1, err
 	}
@@ -123,6 +166,11 @@ func (b *B2) makeUploadRequest(uploadUrlToken *UploadUrlToken, body []byte,
 	return response, contentSha1, nil
 }
 
+// EncodeFileName percent-encode a file name for headers and download urls, "/" is kept.
+func EncodeFileName(fileName string) string {
+	return strings.Replace(url.PathEscape(fileName), "%2F", "/", -1)
+}
+
 func unmarshalResponseBody(response *http.Response, s interface{}) error {
 	body, err := ioutil.ReadAll(response.Body)
 	if err != nil {
@@ -136,6 +184,12 @@ func unmarshalResponseBody(response *http.Response, s interface{}) error {
 	return nil
 }
 
+// GetKeyFromEnv return the application key id and the application key from environment.
+// B2_APPLICATION_KEY_ID is preferred, B2_ACCOUNT_ID is read for compatibility.
 func GetKeyFromEnv() (string, string) {
-	return os.Getenv("B2_ACCOUNT_ID"), os.Getenv("B2_APPLICATION_KEY")
+	keyId := os.Getenv("B2_APPLICATION_KEY_ID")
+	if keyId == "" {
+		keyId = os.Getenv("B2_ACCOUNT_ID")
+	}
+	return keyId, os.Getenv("B2_APPLICATION_KEY")
 }